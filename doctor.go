@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+// runDoctor runs patrol doctor, which reports import cycles, packages nothing
+// imports and imports of missing packages, and returns the exit code: 1 if any
+// problem was found, 2 on errors.
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: patrol doctor [<path>]\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args) // nolint
+
+	repoPath := "."
+	if flags.NArg() > 0 {
+		repoPath = flags.Arg(0)
+	}
+
+	repo, err := patrol.NewRepo(repoPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 2
+	}
+
+	diagnostics, err := repo.Diagnose()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 2
+	}
+
+	for _, d := range diagnostics {
+		fmt.Println(d)
+	}
+
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+const graphUsage = `usage:
+	patrol graph rdeps [-direct] <package> [<path>]
+	patrol graph top [-n 20] [<path>]
+	patrol graph path <from package> <to package> [<path>]
+
+Packages are import paths (standard library and external ones too) or
+directories relative to the repository root (e.g. ./pkg/foo). The path to the
+repository defaults to the current directory.
+`
+
+// runGraph runs patrol graph, which queries the graph of packages of the
+// repository, and returns the exit code.
+func runGraph(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, graphUsage)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("graph "+args[0], flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), graphUsage)
+		flags.PrintDefaults()
+	}
+
+	var filter patrol.PackageFilter
+	flags.Var((*patternsFlag)(&filter.Match), "match", "only report packages matching "+
+		"this package pattern, can be repeated")
+	flags.Var((*patternsFlag)(&filter.Exclude), "exclude", "don't report packages matching "+
+		"this package pattern, can be repeated")
+
+	var direct *bool
+	var top *int
+	var positional int
+	switch args[0] {
+	case "rdeps":
+		direct = flags.Bool("direct", false, "only report packages importing the package directly")
+		positional = 1
+	case "top":
+		top = flags.Int("n", 20, "number of packages to report")
+	case "path":
+		positional = 2
+	default:
+		fmt.Fprintf(os.Stderr, "unknown graph command: %s\n\n%s", args[0], graphUsage)
+		return 1
+	}
+
+	flags.Parse(args[1:]) // nolint
+
+	if flags.NArg() < positional || flags.NArg() > positional+1 {
+		flags.Usage()
+		return 1
+	}
+
+	repoPath := "."
+	if flags.NArg() > positional {
+		repoPath = flags.Arg(positional)
+	}
+
+	repo, err := patrol.NewRepo(repoPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	switch args[0] {
+	case "rdeps":
+		var dependants []*patrol.Package
+		if *direct {
+			dependants, err = repo.DirectDependants(flags.Arg(0))
+		} else {
+			dependants, err = repo.TransitiveDependants(flags.Arg(0))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 1
+		}
+
+		var names []string
+		for _, d := range dependants {
+			names = append(names, d.Name)
+		}
+		for _, name := range repo.FilterPackages(names, filter) {
+			fmt.Println(name)
+		}
+	case "top":
+		var counts []patrol.DependantCount
+		for _, c := range repo.DependantCounts() {
+			if len(counts) == *top {
+				break
+			}
+			if len(repo.FilterPackages([]string{c.Package.Name}, filter)) > 0 {
+				counts = append(counts, c)
+			}
+		}
+
+		if err := printDependantCounts(os.Stdout, counts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 1
+		}
+	case "path":
+		path, err := repo.ImportPath(flags.Arg(0), flags.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 1
+		}
+		if path == nil {
+			fmt.Fprintf(os.Stderr, "%s does not depend on %s\n", flags.Arg(0), flags.Arg(1))
+			return 1
+		}
+
+		for _, name := range path {
+			fmt.Println(name)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+// runLintImports runs patrol lint-imports, which checks imports against the
+// rules in the configuration file, and returns the exit code: 1 if any import
+// breaks them, 2 on errors.
+func runLintImports(args []string) int {
+	flags := flag.NewFlagSet("lint-imports", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: patrol lint-imports [-config=.patrol.json] [-from=<revision>] [-tests] [<path>]\n")
+		flags.PrintDefaults()
+	}
+
+	config := flags.String("config", "", "configuration file with the import rules "+
+		"(default .patrol.json at the root of the repository)")
+	revision := flags.String("from", "", "only check packages changed since this revision, "+
+		"or since the base revision worked out from the CI environment with auto")
+	tests := flags.Bool("tests", false, "also check the imports of _test.go files, making "+
+		"packages imported by tests dependencies too (as with patrol -tests=include)")
+
+	flags.Parse(args) // nolint
+
+	repoPath := "."
+	if flags.NArg() > 0 {
+		repoPath = flags.Arg(0)
+	}
+
+	if *config == "" {
+		*config = filepath.Join(repoPath, ".patrol.json")
+	}
+
+	cfg, err := patrol.ReadConfig(*config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 2
+	}
+
+	var options []patrol.Option
+	if *tests {
+		options = append(options, patrol.Tests(patrol.TestsInclude))
+	}
+
+	repo, err := patrol.NewRepo(repoPath, options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 2
+	}
+
+	if *revision == "auto" {
+		base, source, err := repo.ResolveBase(context.Background(), os.Getenv, patrol.DefaultBaseResolvers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not resolve base revision: %s\n", err.Error())
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "using base revision %s (%s)\n", base, source)
+		*revision = base
+	}
+
+	var packages []string
+	if *revision != "" {
+		packages, err = repo.ChangesFrom(*revision, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 2
+		}
+		if packages == nil {
+			// nothing changed, nothing to check
+			return 0
+		}
+	}
+
+	violations, err := repo.CheckImports(cfg.ImportRules, packages)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 2
+	}
+
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+
+	if len(violations) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+// runLog runs patrol log, which lists the packages affected by each commit
+// in a range, and returns the exit code.
+func runLog(args []string) int {
+	flags := flag.NewFlagSet("log", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: patrol log -from=<revision> [-to=<revision>] [flags] <path>\n")
+		flags.PrintDefaults()
+	}
+
+	from := flags.String("from", "", "revision the range starts from (excluded)")
+	to := flags.String("to", "HEAD", "revision the range ends at (included)")
+	firstParent := flags.Bool("first-parent", true, "only follow the first parent of merge commits")
+	allFiles := flags.Bool("all-files", false, "detect changes in all files, not just go files")
+	semanticDiff := flags.Bool("semantic-diff", false, "ignore changes to go files "+
+		"that only affect comments or formatting")
+	symbols := flags.Bool("symbols", false, "only flag dependants referencing "+
+		"the declarations that changed")
+	modCache := flags.String("modcache", "", "module cache used to work out which "+
+		"packages of updated dependencies changed")
+	modGraph := flags.String("modgraph", "", "file containing the output of go mod graph, "+
+		"used to flag importers of modules requiring changed dependencies")
+
+	var filter patrol.PackageFilter
+	flags.Var((*patternsFlag)(&filter.Match), "match", "only report packages matching "+
+		"this package pattern, can be repeated")
+	flags.Var((*patternsFlag)(&filter.Exclude), "exclude", "don't report packages matching "+
+		"this package pattern, can be repeated")
+
+	flags.Parse(args) // nolint
+
+	if flags.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "please provide the path to the repository\n")
+		return 1
+	}
+
+	if *from == "" {
+		fmt.Fprintf(os.Stderr, "please set `from` flag:\n\tpatrol log -from=v1.0.0 -to=v1.1.0 .\n")
+		return 1
+	}
+
+	var options []patrol.Option
+	if *semanticDiff {
+		options = append(options, patrol.SemanticDiff())
+	}
+	if *symbols {
+		options = append(options, patrol.SymbolLevel())
+	}
+	if *modCache != "" {
+		options = append(options, patrol.ModCache(*modCache))
+	}
+	if *modGraph != "" {
+		options = append(options, patrol.ModGraph(*modGraph))
+	}
+
+	repo, err := patrol.NewRepo(flags.Arg(0), options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	log, err := repo.Log(*from, *to, *firstParent, *allFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	for i := range log {
+		log[i].Changes = repo.FilterPackages(log[i].Changes, filter)
+	}
+
+	if err := printLog(os.Stdout, log); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
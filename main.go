@@ -1,18 +1,122 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"go/build"
+	"io"
+	"log"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
 
 	"github.com/utilitywarehouse/patrol/patrol"
 )
 
+// errInvalidFlags is the error patrol fails with when flags or arguments are
+// missing or can't be used together.
+var errInvalidFlags = errors.New("invalid flags")
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "log":
+			os.Exit(runLog(os.Args[2:]))
+		case "stats":
+			os.Exit(runStats(os.Args[2:]))
+		case "graph":
+			os.Exit(runGraph(os.Args[2:]))
+		case "lint-imports":
+			os.Exit(runLintImports(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		}
+	}
+
 	revision := flag.String("from", "", "revision that should be used to detected "+
-		"changes in HEAD.\nE.g.: -from=a0e002f951f56d53d552f9427b3331b11ea66e92")
+		"changes in HEAD, or auto to work it out from the CI environment.\n"+
+		"E.g.: -from=a0e002f951f56d53d552f9427b3331b11ea66e92")
+
+	allFiles := flag.Bool("all-files", false, "detect changes in all files, not just "+
+		"source files (.go, .c, .s...)")
+
+	semanticDiff := flag.Bool("semantic-diff", false, "ignore changes to go files "+
+		"that only affect comments or formatting")
+
+	apiSurface := flag.Bool("api-surface", false, "compare the exported API of "+
+		"changed packages and report the kind of change next to each package")
+
+	symbols := flag.Bool("symbols", false, "only flag dependants referencing "+
+		"the declarations that changed (takes precedence over -api-surface)")
+
+	modCache := flag.String("modcache", "", "module cache used to work out which "+
+		"packages of updated dependencies changed.\nE.g.: -modcache=$(go env GOMODCACHE)")
+
+	modGraph := flag.String("modgraph", "", "file containing the output of go mod graph, "+
+		"used to flag importers of modules requiring changed dependencies")
+
+	onMissingBase := flag.String("on-missing-base", string(patrol.MissingBaseError), "what to do "+
+		"if the base revision (or its go.mod) can't be found: error, all (report every package) "+
+		"or none")
+
+	format := flag.String("format", "text", "output format: text (one package per line) "+
+		"or github-matrix (JSON suited to a GitHub Actions strategy.matrix)")
+
+	output := flag.String("output", "importpath", "how packages are printed in the text "+
+		"format: importpath, dir (directory relative to the repository root) or both")
+
+	githubOutput := flag.Bool("github-output", false, "also write the changed, count, "+
+		"any_changed and matrix step outputs to the $GITHUB_OUTPUT file")
+
+	exitCode := flag.Bool("exit-code", false, "exit with 1 if any package changed and 0 "+
+		"otherwise, like git diff --exit-code. Errors exit with 2")
+
+	continueOnParseErrors := flag.Bool("continue-on-parse-errors", false, "skip go files "+
+		"that can't be parsed (printing a warning) rather than failing")
+
+	var ignore []string
+	flag.Var((*patternsFlag)(&ignore), "ignore", "ignore the files and directories matching "+
+		"this pattern (as in path.Match), can be repeated. Patterns without a slash match file and "+
+		"directory names at any depth.\nE.g.: -ignore=docs -ignore='*.md' -ignore='services/*/testdata'")
+
+	buildConstraints := flag.Bool("build-constraints", false, "ignore go files excluded by "+
+		"build constraints for $GOOS and $GOARCH (implied by -tags)")
+
+	tags := flag.String("tags", "", "comma separated list of build tags considered "+
+		"satisfied by build constraints")
+
+	tests := flag.String("tests", string(patrol.TestsChange), "how tests are handled: change "+
+		"(changed tests flag their package), ignore (changes to tests are ignored) or include "+
+		"(packages imported by tests are dependencies too)")
+
+	worktree := flag.Bool("worktree", false, "also detect uncommitted changes in the working tree")
+
+	mergeBase := flag.Bool("merge-base", false, "compare with the merge base of the base "+
+		"revision and HEAD, like git diff from...HEAD")
 
-	allFiles := flag.Bool("all-files", false, "detect changes in all files, not just go files")
+	target := flag.String("to", "", "detect changes in this revision rather than HEAD")
+
+	vcs := flag.String("vcs", string(patrol.VCSGoGit), "how changes are read from git: go-git "+
+		"or git (runs the git command, faster on large repositories and partial clones)")
+
+	changedFiles := flag.String("changed-files", "", "file listing the changed files (one per "+
+		"line or NUL separated, as printed by git diff --name-only [-z]), or - to read them "+
+		"from stdin, instead of detecting changes with git.\nE.g.: git diff --name-only main | "+
+		"patrol -changed-files=- .")
+
+	oldGoMod := flag.String("old-go-mod", "", "go.mod file before the changes, used with "+
+		"-changed-files to detect changes in required modules")
+
+	verbose := flag.Bool("v", false, "log what patrol does to stderr")
+
+	var filter patrol.PackageFilter
+	flag.Var((*patternsFlag)(&filter.Match), "match", "only report packages matching "+
+		"this package pattern, can be repeated.\nE.g.: -match=./services/...")
+	flag.Var((*patternsFlag)(&filter.Exclude), "exclude", "don't report packages matching "+
+		"this package pattern, can be repeated")
 
 	flag.Parse()
 
@@ -20,29 +124,206 @@ func main() {
 
 	if len(args) < 1 {
 		fmt.Fprintf(os.Stderr, "please provide the path to the repository\n")
-		os.Exit(1)
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
+	}
+
+	if *changedFiles != "" && *revision != "" {
+		fmt.Fprintf(os.Stderr, "`from` and `changed-files` flags can't be used together\n")
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
+	}
+
+	if *changedFiles != "" && (*mergeBase || *target != "" || *worktree) {
+		fmt.Fprintf(os.Stderr, "`merge-base`, `to` and `worktree` flags can't be used with `changed-files`\n")
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
+	}
+
+	if *oldGoMod != "" && *changedFiles == "" {
+		fmt.Fprintf(os.Stderr, "`old-go-mod` flag can only be used with `changed-files`\n")
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
 	}
 
-	if *revision == "" {
+	if *revision == "" && *changedFiles == "" {
 		fmt.Fprintf(os.Stderr, "please set `from` flag:\n\tpatrol -from=a0e002f951f56d53d552f9427b3331b11ea66e92 .\n")
-		os.Exit(1)
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
+	}
+
+	if *format != "text" && *format != "github-matrix" {
+		fmt.Fprintf(os.Stderr, "invalid value for `format` flag: %s\n", *format)
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
+	}
+
+	if *output != "importpath" && *output != "dir" && *output != "both" {
+		fmt.Fprintf(os.Stderr, "invalid value for `output` flag: %s\n", *output)
+		os.Exit(exitStatus(*exitCode, nil, errInvalidFlags))
 	}
 
 	repoPath := args[0]
 
-	repo, err := patrol.NewRepo(repoPath)
+	options := []patrol.Option{
+		patrol.Tests(patrol.TestMode(*tests)),
+		patrol.Ignore(ignore...),
+		patrol.VCS(patrol.VCSBackend(*vcs)),
+		patrol.OnMissingBase(patrol.MissingBasePolicy(*onMissingBase)),
+	}
+	if *allFiles {
+		options = append(options, patrol.AllFiles())
+	}
+	if *continueOnParseErrors {
+		options = append(options, patrol.ContinueOnParseErrors())
+	}
+	if *buildConstraints || *tags != "" {
+		ctxt := build.Default
+		if *tags != "" {
+			ctxt.BuildTags = strings.Split(*tags, ",")
+		}
+		options = append(options, patrol.BuildContext(&ctxt))
+	}
+	if *semanticDiff {
+		options = append(options, patrol.SemanticDiff())
+	}
+	if *apiSurface {
+		options = append(options, patrol.APISurface())
+	}
+	if *symbols {
+		options = append(options, patrol.SymbolLevel())
+	}
+	if *modCache != "" {
+		options = append(options, patrol.ModCache(*modCache))
+	}
+	if *modGraph != "" {
+		options = append(options, patrol.ModGraph(*modGraph))
+	}
+	if *worktree {
+		options = append(options, patrol.Worktree())
+	}
+	if *mergeBase {
+		options = append(options, patrol.MergeBase())
+	}
+	if *target != "" {
+		options = append(options, patrol.Target(*target))
+	}
+	if *verbose {
+		options = append(options, patrol.Logger(log.New(os.Stderr, "patrol: ", 0)))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	repo, err := patrol.NewRepoContext(ctx, repoPath, options...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
-		os.Exit(1)
+		os.Exit(exitStatus(*exitCode, nil, err))
+	}
+	for _, warning := range repo.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning.Error())
+	}
+
+	if *revision == "auto" {
+		base, source, err := repo.ResolveBase(ctx, os.Getenv, patrol.DefaultBaseResolvers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not resolve base revision: %s\n", err.Error())
+			os.Exit(exitStatus(*exitCode, nil, err))
+		}
+		fmt.Fprintf(os.Stderr, "using base revision %s (%s)\n", base, source)
+		*revision = base
 	}
 
-	changes, err := repo.ChangesFrom(*revision, *allFiles)
+	var changes []string
+	if *changedFiles != "" {
+		changes, err = changesFromFiles(ctx, repo, *changedFiles, *oldGoMod)
+	} else {
+		changes, err = repo.Changes(ctx, *revision)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
-		os.Exit(1)
+		os.Exit(exitStatus(*exitCode, nil, err))
 	}
 
 	for _, c := range changes {
-		fmt.Println(c)
+		if reason := repo.Packages[c].Reason; reason != "" {
+			fmt.Fprintf(os.Stderr, "warning: %s, reporting all packages as changed\n", reason)
+			break
+		}
+	}
+
+	changes = repo.FilterPackages(changes, filter)
+	sort.Strings(changes)
+
+	if *githubOutput {
+		err := writeGitHubOutput(os.Getenv("GITHUB_OUTPUT"), repo, changes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not write GitHub output: %s\n", err.Error())
+			os.Exit(exitStatus(*exitCode, nil, err))
+		}
+	}
+
+	err = printChanges(os.Stdout, repo, changes, *format, *output, *apiSurface)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(exitStatus(*exitCode, nil, err))
+	}
+
+	if status := exitStatus(*exitCode, changes, nil); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// exitStatus returns the code patrol exits with, after finding changes or
+// failing with err. It's always 1 on errors and 0 otherwise, unless exitCode
+// (-exit-code) is set: then changes exit with 1 and errors with 2, like git
+// diff --exit-code.
+func exitStatus(exitCode bool, changes []string, err error) int {
+	switch {
+	case err != nil && exitCode:
+		return 2
+	case err != nil:
+		return 1
+	case exitCode && len(changes) > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// patternsFlag is a flag that can be repeated to set multiple package
+// patterns.
+type patternsFlag []string
+
+func (f *patternsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *patternsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// changesFromFiles returns the packages affected by the files listed in the
+// file named changedFiles (or stdin if it's -) and, if oldGoMod isn't empty,
+// by the differences between the go.mod file it names and the current one.
+func changesFromFiles(ctx context.Context, repo *patrol.Repo, changedFiles, oldGoMod string) ([]string, error) {
+	var in io.Reader = os.Stdin
+	if changedFiles != "-" {
+		f, err := os.Open(changedFiles)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close() // nolint
+		in = f
+	}
+
+	files, err := patrol.ReadChangedFiles(in)
+	if err != nil {
+		return nil, err
 	}
+
+	var mod []byte
+	if oldGoMod != "" {
+		mod, err = os.ReadFile(oldGoMod)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return repo.ChangesFromFiles(ctx, files, mod)
 }
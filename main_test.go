@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitStatus(t *testing.T) {
+	changes := []string{"github.com/utilitywarehouse/patrol/patrol"}
+	err := errors.New("failed")
+
+	tests := []struct {
+		name     string
+		exitCode bool
+		changes  []string
+		err      error
+		expected int
+	}{
+		{name: "no changes", expected: 0},
+		{name: "changes", changes: changes, expected: 0},
+		{name: "error", err: err, expected: 1},
+		{name: "exit code without changes", exitCode: true, expected: 0},
+		{name: "exit code with changes", exitCode: true, changes: changes, expected: 1},
+		{name: "exit code with error", exitCode: true, err: err, expected: 2},
+		{name: "exit code with invalid flags", exitCode: true, err: errInvalidFlags, expected: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, exitStatus(test.exitCode, test.changes, test.err))
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+// matrixEntry is an entry of a GitHub Actions strategy.matrix.include list.
+type matrixEntry struct {
+	Package string `json:"package"`
+	Dir     string `json:"dir"`
+	Binary  string `json:"binary,omitempty"`
+}
+
+// githubMatrix returns a GitHub Actions matrix with an entry for each of the
+// changed packages, e.g.: {"include":[{"package":"...","dir":"..."}]}.
+func githubMatrix(repo *patrol.Repo, changes []string) ([]byte, error) {
+	matrix := struct {
+		Include []matrixEntry `json:"include"`
+	}{
+		Include: []matrixEntry{},
+	}
+
+	for _, c := range changes {
+		entry := matrixEntry{
+			Package: c,
+			Dir:     repo.Packages[c].Dir,
+		}
+		if repo.Packages[c].Main {
+			entry.Binary = binaryName(c)
+		}
+		matrix.Include = append(matrix.Include, entry)
+	}
+
+	return json.Marshal(matrix)
+}
+
+// writeGitHubOutput appends the changed, count and any_changed step outputs
+// (and the matrix, as in -format=github-matrix) to the GitHub Actions output
+// file at path.
+func writeGitHubOutput(path string, repo *patrol.Repo, changes []string) error {
+	list, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	if changes == nil {
+		list = []byte("[]")
+	}
+
+	matrix, err := githubMatrix(repo, changes)
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		return errors.New("GITHUB_OUTPUT is not set")
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "changed=%s\ncount=%d\nany_changed=%t\nmatrix=%s\n",
+		list, len(changes), len(changes) > 0, matrix)
+	if err != nil {
+		f.Close() // nolint
+		return err
+	}
+
+	return f.Close()
+}
+
+// printChanges writes the changes to w in the given format. In the text
+// format, output selects whether packages are printed as import paths
+// (importpath), directories (dir) or both, separated by a tab.
+func printChanges(w io.Writer, repo *patrol.Repo, changes []string, format, output string, withKind bool) error {
+	switch format {
+	case "github-matrix":
+		matrix, err := githubMatrix(repo, changes)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", matrix)
+		return err
+	default:
+		for _, c := range changes {
+			line := c
+			switch output {
+			case "dir":
+				line = repo.Packages[c].Dir
+			case "both":
+				line = c + "\t" + repo.Packages[c].Dir
+			}
+			if withKind {
+				line += "\t" + repo.Packages[c].ChangeKind.String()
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// printLog writes the packages affected by each commit to w, under a line
+// with the abbreviated commit hash and its subject, like git log --oneline.
+func printLog(w io.Writer, log []patrol.CommitChanges) error {
+	for _, commit := range log {
+		if _, err := fmt.Fprintf(w, "%.7s %s\n", commit.Hash, commit.Subject); err != nil {
+			return err
+		}
+		for _, c := range commit.Changes {
+			if _, err := fmt.Fprintf(w, "\t%s\n", c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printStats writes the stats to w in the given format: table (a table of
+// packages followed by a table of dependencies) or csv (a single table, where
+// dependencies have no affected count).
+func printStats(w io.Writer, stats *patrol.Stats, format string) error {
+	if format == "csv" {
+		out := csv.NewWriter(w)
+		records := [][]string{{"kind", "name", "changed", "affected", "avg_fan_out"}}
+		for _, pkg := range stats.Packages {
+			records = append(records, []string{"package", pkg.Name, strconv.Itoa(pkg.Changed),
+				strconv.Itoa(pkg.Affected), strconv.FormatFloat(pkg.FanOut, 'f', 2, 64)})
+		}
+		for _, dep := range stats.Dependencies {
+			records = append(records, []string{"dependency", dep.Module, strconv.Itoa(dep.Changed),
+				"", strconv.FormatFloat(dep.FanOut, 'f', 2, 64)})
+		}
+		return out.WriteAll(records)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d commits\n\n", stats.Commits)
+	fmt.Fprintf(tw, "PACKAGE\tCHANGED\tAFFECTED\tAVG FAN-OUT\n")
+	for _, pkg := range stats.Packages {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\n", pkg.Name, pkg.Changed, pkg.Affected, pkg.FanOut)
+	}
+	if len(stats.Dependencies) > 0 {
+		fmt.Fprintf(tw, "\nDEPENDENCY\tCHANGED\tREBUILDS\tAVG FAN-OUT\n")
+		for _, dep := range stats.Dependencies {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\n", dep.Module, dep.Changed, dep.Rebuilds, dep.FanOut)
+		}
+	}
+	return tw.Flush()
+}
+
+// printDependantCounts writes a table with the number of direct and
+// transitive dependants of each package to w.
+func printDependantCounts(w io.Writer, counts []patrol.DependantCount) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PACKAGE\tDIRECT\tTRANSITIVE\n")
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", c.Package.Name, c.Direct, c.Transitive)
+	}
+	return tw.Flush()
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// binaryName returns the name go build gives to the binary of the command
+// with the given import path.
+func binaryName(pkg string) string {
+	name := path.Base(pkg)
+	if majorVersion.MatchString(name) && path.Dir(pkg) != "." {
+		return path.Base(path.Dir(pkg))
+	}
+	return name
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestGitHubMatrix(t *testing.T) {
+	repo, err := patrol.NewRepo("patrol/testdata/apisurface/commits/1")
+	require.NoError(t, err)
+
+	changes := []string{
+		"github.com/utilitywarehouse/apisurface/cmd/app",
+		"github.com/utilitywarehouse/apisurface/pkg/foo",
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printChanges(&out, repo, changes, "github-matrix", "importpath", false))
+	assert.JSONEq(t, `{"include": [
+		{"package": "github.com/utilitywarehouse/apisurface/cmd/app", "dir": "cmd/app", "binary": "app"},
+		{"package": "github.com/utilitywarehouse/apisurface/pkg/foo", "dir": "pkg/foo"}
+	]}`, out.String())
+
+	out.Reset()
+	require.NoError(t, printChanges(&out, repo, nil, "github-matrix", "importpath", false))
+	assert.JSONEq(t, `{"include": []}`, out.String())
+}
+
+func TestWriteGitHubOutput(t *testing.T) {
+	repo, err := patrol.NewRepo("patrol/testdata/apisurface/commits/1")
+	require.NoError(t, err)
+
+	output := filepath.Join(t.TempDir(), "output")
+	require.NoError(t, os.WriteFile(output, []byte("previous=step\n"), 0600))
+
+	err = writeGitHubOutput(output, repo, []string{"github.com/utilitywarehouse/apisurface/cmd/app"})
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "previous=step\n"+
+		`changed=["github.com/utilitywarehouse/apisurface/cmd/app"]`+"\n"+
+		"count=1\n"+
+		"any_changed=true\n"+
+		`matrix={"include":[{"package":"github.com/utilitywarehouse/apisurface/cmd/app","dir":"cmd/app","binary":"app"}]}`+"\n",
+		string(b))
+
+	empty := filepath.Join(t.TempDir(), "output")
+	require.NoError(t, writeGitHubOutput(empty, repo, nil))
+
+	b, err = os.ReadFile(empty)
+	require.NoError(t, err)
+	assert.Equal(t, "changed=[]\ncount=0\nany_changed=false\nmatrix={\"include\":[]}\n", string(b))
+}
+
+func TestBinaryName(t *testing.T) {
+	assert.Equal(t, "app", binaryName("github.com/org/repo/cmd/app"))
+	assert.Equal(t, "repo", binaryName("github.com/org/repo/v2"))
+}
+
+func TestPrintChangesOutput(t *testing.T) {
+	repo, err := patrol.NewRepo("patrol/testdata/apisurface/commits/1")
+	require.NoError(t, err)
+
+	changes := []string{"github.com/utilitywarehouse/apisurface/pkg/foo"}
+
+	var out bytes.Buffer
+	require.NoError(t, printChanges(&out, repo, changes, "text", "importpath", false))
+	assert.Equal(t, "github.com/utilitywarehouse/apisurface/pkg/foo\n", out.String())
+
+	out.Reset()
+	require.NoError(t, printChanges(&out, repo, changes, "text", "dir", false))
+	assert.Equal(t, "pkg/foo\n", out.String())
+
+	out.Reset()
+	require.NoError(t, printChanges(&out, repo, changes, "text", "both", false))
+	assert.Equal(t, "github.com/utilitywarehouse/apisurface/pkg/foo\tpkg/foo\n", out.String())
+}
+
+func TestPrintLog(t *testing.T) {
+	log := []patrol.CommitChanges{
+		{
+			Hash:    "a0e002f951f56d53d552f9427b3331b11ea66e92",
+			Subject: "Update foo",
+			Changes: []string{"github.com/org/repo/cmd/app", "github.com/org/repo/pkg/foo"},
+		},
+		{
+			Hash:    "0a359e246ba3c7c76b0ad0e1d734ae103455b7a9",
+			Subject: "Update README",
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printLog(&out, log))
+	assert.Equal(t, "a0e002f Update foo\n"+
+		"\tgithub.com/org/repo/cmd/app\n"+
+		"\tgithub.com/org/repo/pkg/foo\n"+
+		"0a359e2 Update README\n", out.String())
+}
+
+func TestPrintStats(t *testing.T) {
+	stats := &patrol.Stats{
+		Commits: 12,
+		Packages: []patrol.PackageStats{
+			{Name: "github.com/org/repo/pkg/foo", Changed: 3, Affected: 1, FanOut: 2.5},
+		},
+		Dependencies: []patrol.DependencyStats{
+			{Module: "github.com/sirupsen/logrus", Changed: 2, Rebuilds: 6, FanOut: 3},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printStats(&out, stats, "csv"))
+	assert.Equal(t, "kind,name,changed,affected,avg_fan_out\n"+
+		"package,github.com/org/repo/pkg/foo,3,1,2.50\n"+
+		"dependency,github.com/sirupsen/logrus,2,,3.00\n", out.String())
+
+	out.Reset()
+	require.NoError(t, printStats(&out, stats, "table"))
+	assert.Equal(t, "12 commits\n\n"+
+		"PACKAGE                      CHANGED  AFFECTED  AVG FAN-OUT\n"+
+		"github.com/org/repo/pkg/foo  3        1         2.50\n"+
+		"\n"+
+		"DEPENDENCY                  CHANGED  REBUILDS  AVG FAN-OUT\n"+
+		"github.com/sirupsen/logrus  2        6         3.00\n", out.String())
+}
+
+func TestPrintDependantCounts(t *testing.T) {
+	counts := []patrol.DependantCount{
+		{Package: &patrol.Package{Name: "github.com/org/repo/pkg/foo"}, Direct: 3, Transitive: 12},
+		{Package: &patrol.Package{Name: "fmt"}, Direct: 5, Transitive: 7},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printDependantCounts(&out, counts))
+	assert.Equal(t, "PACKAGE                      DIRECT  TRANSITIVE\n"+
+		"github.com/org/repo/pkg/foo  3       12\n"+
+		"fmt                          5       7\n", out.String())
+}
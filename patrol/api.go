@@ -0,0 +1,358 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ChangeKind describes how a package was affected by the changes detected by
+// ChangesFrom. Kinds are ordered, a package affected in more than one way
+// reports the strongest one.
+type ChangeKind int
+
+const (
+	// Unchanged packages were not affected by any change.
+	Unchanged ChangeKind = iota
+	// AffectedRebuildOnly packages didn't change themselves, but depend on
+	// packages whose implementation changed. They need to be rebuilt, but
+	// their behaviour contract is the same.
+	AffectedRebuildOnly
+	// ChangedImplementation packages changed, but their exported API is
+	// still the same.
+	ChangedImplementation
+	// ChangedAPI packages changed in a way that could affect their
+	// dependants. Unless APISurface is used, every change is of this kind.
+	ChangedAPI
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Unchanged:
+		return "unchanged"
+	case AffectedRebuildOnly:
+		return "affected (rebuild only)"
+	case ChangedImplementation:
+		return "changed (implementation)"
+	case ChangedAPI:
+		return "changed"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// propagated returns the kind of change the dependants of a package affected
+// by k are affected by.
+func (k ChangeKind) propagated() ChangeKind {
+	if k == ChangedAPI {
+		return ChangedAPI
+	}
+	return AffectedRebuildOnly
+}
+
+// apiChangedBetween returns true if the exported API of the package in dir
+// differs between the two given commits.
+func apiChangedBetween(ctx context.Context, v vcs, now, then, dir string) (bool, error) {
+	nowFiles, err := goFilesAt(ctx, v, now, dir)
+	if err != nil {
+		return false, err
+	}
+
+	thenFiles, err := goFilesAt(ctx, v, then, dir)
+	if err != nil {
+		return false, err
+	}
+
+	if nowFiles == nil || thenFiles == nil {
+		// the package was either added or removed, or some of its files can't
+		// be parsed
+		return true, nil
+	}
+
+	return !reflect.DeepEqual(exportedAPI(nowFiles), exportedAPI(thenFiles)), nil
+}
+
+// goFilesAt parses all the non test .go files found in dir at commit. It
+// returns nil if there are no such files or if any of them can't be parsed.
+func goFilesAt(ctx context.Context, v vcs, commit, dir string) ([]*ast.File, error) {
+	names, err := v.readDir(ctx, commit, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		contents, err := v.readFile(ctx, commit, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := parser.ParseFile(fset, path.Join(dir, name), contents, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, nil
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// exportedAPI returns a description of every exported identifier declared in
+// files, keyed by identifier (methods are keyed as Type.Method). Two versions
+// of a package with the same description have a compatible exported API.
+// Identifiers declared more than once, in files with different build
+// constraints, are described by all their declarations.
+func exportedAPI(files []*ast.File) map[string]string {
+	declared := map[string][]string{}
+	constants := map[string]*constantDecl{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if !ast.IsExported(decl.Name.Name) {
+					continue
+				}
+				name, description := decl.Name.Name, "func"
+				if decl.Recv != nil && len(decl.Recv.List) > 0 {
+					recv := receiverTypeName(decl.Recv.List[0].Type)
+					if !ast.IsExported(recv) {
+						continue
+					}
+					name = recv + "." + name
+					// pointer receivers change the method set of the type
+					description += " (" + types.ExprString(decl.Recv.List[0].Type) + ")"
+				}
+				declared[name] = append(declared[name], description+fieldListString(decl.Type.TypeParams)+signatureString(decl.Type))
+			case *ast.GenDecl:
+				addGenDeclAPI(declared, constants, decl)
+			}
+		}
+	}
+
+	api := map[string]string{}
+	for name, descriptions := range declared {
+		slices.Sort(descriptions)
+		api[name] = strings.Join(slices.Compact(descriptions), " | ")
+		if _, ok := constants[name]; ok {
+			api[name] += unexportedConstants(constants, name)
+		}
+	}
+	return api
+}
+
+// constantDecl is a package level constant, exported or not.
+type constantDecl struct {
+	descriptions []string
+	// identifiers referenced by the type and value of the constant
+	references []string
+}
+
+// unexportedConstants describes the unexported constants the value of the
+// constant with the given name depends on, directly or through other
+// constants: changing their value changes the value of the exported one.
+func unexportedConstants(constants map[string]*constantDecl, name string) string {
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	var result []string
+	for len(queue) > 0 {
+		current := constants[queue[0]]
+		queue = queue[1:]
+		for _, ref := range current.references {
+			if visited[ref] || constants[ref] == nil {
+				continue
+			}
+			visited[ref] = true
+			queue = append(queue, ref)
+			if !ast.IsExported(ref) {
+				for _, description := range constants[ref].descriptions {
+					result = append(result, ref+" "+description)
+				}
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return ""
+	}
+	slices.Sort(result)
+	return " (uses " + strings.Join(slices.Compact(result), ", ") + ")"
+}
+
+// addGenDeclAPI adds the descriptions of the exported constants, variables
+// and types declared in decl to declared, and all the constants to
+// constants.
+func addGenDeclAPI(declared map[string][]string, constants map[string]*constantDecl, decl *ast.GenDecl) {
+	// constants in a group can implicitly repeat the last type and values
+	var lastType ast.Expr
+	var lastValues []ast.Expr
+
+	for index, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			if !ast.IsExported(spec.Name.Name) {
+				continue
+			}
+			description := "type" + fieldListString(spec.TypeParams)
+			if spec.Assign.IsValid() {
+				description += " = "
+			} else {
+				description += " "
+			}
+			declared[spec.Name.Name] = append(declared[spec.Name.Name], description+typeString(spec.Type))
+		case *ast.ValueSpec:
+			typ, values := spec.Type, spec.Values
+			if decl.Tok == token.CONST && typ == nil && len(values) == 0 {
+				typ, values = lastType, lastValues
+			}
+			lastType, lastValues = typ, values
+
+			for i, name := range spec.Names {
+				if !ast.IsExported(name.Name) && decl.Tok != token.CONST {
+					continue
+				}
+				description := decl.Tok.String()
+				if typ != nil {
+					description += " " + types.ExprString(typ)
+				}
+				if i < len(values) {
+					description += " = " + types.ExprString(values[i])
+				}
+				if decl.Tok == token.CONST {
+					description += fmt.Sprintf(" (iota %d)", index)
+					addConstant(constants, name.Name, description, typ, values, i)
+				}
+				if ast.IsExported(name.Name) {
+					declared[name.Name] = append(declared[name.Name], description)
+				}
+			}
+		}
+	}
+}
+
+// addConstant records the constant with the given name and description,
+// declared with typ and the i-th of values, in constants.
+func addConstant(constants map[string]*constantDecl, name, description string, typ ast.Expr, values []ast.Expr, i int) {
+	if name == "_" {
+		return
+	}
+
+	c, ok := constants[name]
+	if !ok {
+		c = &constantDecl{}
+		constants[name] = c
+	}
+	c.descriptions = append(c.descriptions, description)
+
+	var exprs []ast.Expr
+	if typ != nil {
+		exprs = append(exprs, typ)
+	}
+	if i < len(values) {
+		exprs = append(exprs, values[i])
+	}
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				// constants of other packages
+				return false
+			case *ast.Ident:
+				c.references = append(c.references, n.Name)
+			}
+			return true
+		})
+	}
+}
+
+// typeString describes the type expression expr, leaving out unexported
+// struct fields which are not part of the API.
+func typeString(expr ast.Expr) string {
+	st, ok := expr.(*ast.StructType)
+	if !ok {
+		return types.ExprString(expr)
+	}
+
+	var fields []string
+	unexported := false
+	for _, field := range st.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			tag = " " + field.Tag.Value
+		}
+		if len(field.Names) == 0 {
+			// embedded fields are promoted, whether exported or not
+			fields = append(fields, types.ExprString(field.Type)+tag)
+			continue
+		}
+		for _, name := range field.Names {
+			if !ast.IsExported(name.Name) {
+				unexported = true
+				continue
+			}
+			fields = append(fields, name.Name+" "+types.ExprString(field.Type)+tag)
+		}
+	}
+	if unexported {
+		// unexported fields still affect whether the struct is comparable
+		fields = append(fields, "// unexported fields")
+	}
+
+	return "struct{" + strings.Join(fields, "; ") + "}"
+}
+
+// signatureString describes the parameters and results of a function, leaving
+// out parameter names which are not part of the API.
+func signatureString(fn *ast.FuncType) string {
+	return fieldListString(fn.Params) + " " + fieldListString(fn.Results)
+}
+
+// fieldListString describes the types of all fields in list.
+func fieldListString(list *ast.FieldList) string {
+	if list == nil {
+		return ""
+	}
+
+	var fields []string
+	for _, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			fields = append(fields, types.ExprString(field.Type))
+		}
+	}
+
+	return "(" + strings.Join(fields, ", ") + ")"
+}
+
+// receiverTypeName returns the name of the type of a method receiver.
+func receiverTypeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(expr.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(expr.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	default:
+		return ""
+	}
+}
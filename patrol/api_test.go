@@ -0,0 +1,288 @@
+package patrol
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportedAPI(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected map[string]string
+	}{
+		{
+			name: "functions",
+			src: `package foo
+func Foo(a, b int, s string) (int, error) { return 0, nil }
+func foo() {}
+`,
+			expected: map[string]string{
+				"Foo": "func(int, int, string) (int, error)",
+			},
+		},
+		{
+			name: "methods",
+			src: `package foo
+type T struct{}
+func (T) Value() {}
+func (t *T) Pointer() {}
+func (t *T) unexported() {}
+type t struct{}
+func (t) Hidden() {}
+`,
+			expected: map[string]string{
+				"T":         "type struct{}",
+				"T.Value":   "func (T)() ",
+				"T.Pointer": "func (*T)() ",
+			},
+		},
+		{
+			name: "generics",
+			src: `package foo
+type List[T any] struct{ Items []T }
+func (l *List[T]) Len() int { return 0 }
+func Map[K comparable, V any](m map[K]V) []V { return nil }
+type Number interface{ ~int | ~float64 }
+`,
+			expected: map[string]string{
+				"List":     "type(any) struct{Items []T}",
+				"List.Len": "func (*List[T])() (int)",
+				"Map":      "func(comparable, any)(map[K]V) ([]V)",
+				"Number":   "type interface{~int | ~float64}",
+			},
+		},
+		{
+			name: "struct fields",
+			src: `package foo
+type T struct {
+	Exported string ` + "`json:\"exported\"`" + `
+	unexported int
+	io.Reader
+	*embedded
+}
+`,
+			expected: map[string]string{
+				"T": "type struct{Exported string `json:\"exported\"`; io.Reader; *embedded; // unexported fields}",
+			},
+		},
+		{
+			name: "aliases",
+			src: `package foo
+type A = string
+type B string
+`,
+			expected: map[string]string{
+				"A": "type = string",
+				"B": "type string",
+			},
+		},
+		{
+			name: "constants",
+			src: `package foo
+const (
+	A Kind = iota
+	B
+	c
+	D
+)
+const E, f, G = 1, 2, 3
+const H = f * 2
+`,
+			expected: map[string]string{
+				"A": "const Kind = iota (iota 0)",
+				"B": "const Kind = iota (iota 1)",
+				"D": "const Kind = iota (iota 3)",
+				"E": "const = 1 (iota 0)",
+				"G": "const = 3 (iota 0)",
+				"H": "const = f * 2 (iota 0) (uses f const = 2 (iota 0))",
+			},
+		},
+		{
+			name: "variables",
+			src: `package foo
+var A, b int
+var C = errors.New("c")
+`,
+			expected: map[string]string{
+				"A": "var int",
+				"C": `var = errors.New("c")`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := parser.ParseFile(token.NewFileSet(), "foo.go", test.src, parser.SkipObjectResolution)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, exportedAPI([]*ast.File{file}))
+		})
+	}
+}
+
+func TestExportedAPIChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		changed bool
+	}{
+		{
+			name: "parameter names",
+			a:    "func Foo(a int) {}",
+			b:    "func Foo(b int) {}",
+		},
+		{
+			name: "function body",
+			a:    "func Foo() int { return 1 }",
+			b:    "func Foo() int { return 2 }",
+		},
+		{
+			name:    "parameter types",
+			a:       "func Foo(a int) {}",
+			b:       "func Foo(a int64) {}",
+			changed: true,
+		},
+		{
+			name:    "grouped parameters",
+			a:       "func Foo(a, b int) {}",
+			b:       "func Foo(a int) {}",
+			changed: true,
+		},
+		{
+			name:    "type constraint",
+			a:       "func Foo[T any](t T) {}",
+			b:       "func Foo[T comparable](t T) {}",
+			changed: true,
+		},
+		{
+			name:    "receiver",
+			a:       "type T struct{}\nfunc (T) Foo() {}",
+			b:       "type T struct{}\nfunc (*T) Foo() {}",
+			changed: true,
+		},
+		{
+			name: "unexported field",
+			a:    "type T struct{ A int; b int }",
+			b:    "type T struct{ A int; c string }",
+		},
+		{
+			name:    "first unexported field",
+			a:       "type T struct{ A int }",
+			b:       "type T struct{ A int; b int }",
+			changed: true,
+		},
+		{
+			name:    "embedded field",
+			a:       "type T struct{ A int }",
+			b:       "type T struct{ A int; inner }",
+			changed: true,
+		},
+		{
+			name:    "struct tag",
+			a:       "type T struct{ A int }",
+			b:       "type T struct{ A int `json:\"a\"` }",
+			changed: true,
+		},
+		{
+			name:    "interface method",
+			a:       "type I interface{ Foo() }",
+			b:       "type I interface{ Foo(); Bar() }",
+			changed: true,
+		},
+		{
+			name:    "reordered constants",
+			a:       "const (\n\tA = iota\n\tB\n)",
+			b:       "const (\n\tB = iota\n\tA\n)",
+			changed: true,
+		},
+		{
+			name:    "unexported constant",
+			a:       "const X = c\nconst c = 2",
+			b:       "const X = c\nconst c = 3",
+			changed: true,
+		},
+		{
+			name:    "unexported constant through another one",
+			a:       "const X = d * 2\nconst d = c + iota\nconst c = 2",
+			b:       "const X = d * 2\nconst d = c + iota\nconst c = 3",
+			changed: true,
+		},
+		{
+			name: "unexported constant of another package",
+			a:    "const X = strings.c\nconst c = 2",
+			b:    "const X = strings.c\nconst c = 3",
+		},
+		{
+			name: "unused unexported constant",
+			a:    "const X = 1\nconst c = 2",
+			b:    "const X = 1\nconst c = 3",
+		},
+		{
+			name:    "alias",
+			a:       "type A = string",
+			b:       "type A string",
+			changed: true,
+		},
+		{
+			name: "unexported declarations",
+			a:    "func foo() {}\ntype t int",
+			b:    "func foo(int) {}\ntype t string",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := func(src string) map[string]string {
+				file, err := parser.ParseFile(token.NewFileSet(), "foo.go", "package foo\n"+src, parser.SkipObjectResolution)
+				require.NoError(t, err)
+				return exportedAPI([]*ast.File{file})
+			}
+
+			if test.changed {
+				assert.NotEqual(t, api(test.a), api(test.b))
+			} else {
+				assert.Equal(t, api(test.a), api(test.b))
+			}
+		})
+	}
+}
+
+func TestExportedAPIBuildConstraints(t *testing.T) {
+	api := func(files map[string]string) map[string]string {
+		fset := token.NewFileSet()
+		var parsed []*ast.File
+		for name, src := range files {
+			file, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+			require.NoError(t, err)
+			parsed = append(parsed, file)
+		}
+		return exportedAPI(parsed)
+	}
+
+	const windows = "package foo\nfunc F(x string) {}\n"
+	before := api(map[string]string{
+		"f_linux.go":   "package foo\nfunc F(x int) {}\n",
+		"f_windows.go": windows,
+	})
+
+	assert.Equal(t, map[string]string{"F": "func(int)  | func(string) "}, before)
+
+	assert.NotEqual(t, before, api(map[string]string{
+		"f_linux.go":   "package foo\nfunc F(x, y int) {}\n",
+		"f_windows.go": windows,
+	}))
+	assert.Equal(t, before, api(map[string]string{
+		"f_linux.go":   "package foo\nfunc F(y int) {}\n",
+		"f_windows.go": windows,
+	}))
+	assert.NotEqual(t, before, api(map[string]string{
+		"f_linux.go":   "package foo\nfunc F(x string) {}\n",
+		"f_windows.go": windows,
+	}))
+}
@@ -0,0 +1,256 @@
+package patrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Getenv returns the value of the environment variable named by key, or an
+// empty string if it isn't set. os.Getenv can be used for the real
+// environment.
+type Getenv func(key string) string
+
+// BaseResolver works out the revision changes should be detected from
+// (the base revision) for a specific CI provider.
+type BaseResolver interface {
+	// Name of the CI provider.
+	Name() string
+
+	// ResolveBase returns the base revision found in the environment, or
+	// false if the build isn't running on this CI provider or the provider
+	// doesn't expose a base revision for it.
+	ResolveBase(getenv Getenv) (string, bool, error)
+}
+
+// BaseResolverFunc is a BaseResolver for the provider named Provider, which
+// resolves the base revision by calling Resolve.
+type BaseResolverFunc struct {
+	Provider string
+	Resolve  func(getenv Getenv) (string, bool, error)
+}
+
+func (f BaseResolverFunc) Name() string {
+	return f.Provider
+}
+
+func (f BaseResolverFunc) ResolveBase(getenv Getenv) (string, bool, error) {
+	return f.Resolve(getenv)
+}
+
+var (
+	// PatrolBase resolves the base revision from PATROL_BASE, which can be
+	// used to override any other resolver or on unsupported CI providers.
+	PatrolBase BaseResolver = BaseResolverFunc{Provider: "PATROL_BASE", Resolve: resolvePatrolBase}
+
+	// GitHubActions resolves the base revision of GitHub Actions pull requests
+	// (the base commit or branch) and pushes (the commit before the push).
+	GitHubActions BaseResolver = BaseResolverFunc{Provider: "GitHub Actions", Resolve: resolveGitHubActions}
+
+	// GitLabCI resolves the base revision of GitLab merge request pipelines
+	// and of push pipelines.
+	GitLabCI BaseResolver = BaseResolverFunc{Provider: "GitLab CI", Resolve: resolveGitLabCI}
+
+	// Drone resolves the base revision of Drone pull request and push
+	// builds.
+	Drone BaseResolver = BaseResolverFunc{Provider: "Drone", Resolve: resolveDrone}
+
+	// Buildkite resolves the base revision of Buildkite pull request builds.
+	Buildkite BaseResolver = BaseResolverFunc{Provider: "Buildkite", Resolve: resolveBuildkite}
+)
+
+// DefaultBaseResolvers are the resolvers used by Repo.ResolveBase when none are
+// given, in the order they're tried.
+var DefaultBaseResolvers = []BaseResolver{PatrolBase, GitHubActions, GitLabCI, Drone, Buildkite}
+
+// zeroCommit is used by CI providers as the previous commit of newly pushed
+// branches.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// ResolveBase returns the base revision changes in the repo should be
+// detected from, together with the name of where it was found. Resolvers are
+// tried in order and if none of them applies, ResolveBase falls back to the
+// merge base between HEAD and the default branch (read with the repo's VCS
+// backend), which stops (returning ctx.Err()) once ctx is done.
+func (r *Repo) ResolveBase(ctx context.Context, getenv Getenv, resolvers []BaseResolver) (string, string, error) {
+	if resolvers == nil {
+		resolvers = DefaultBaseResolvers
+	}
+
+	for _, resolver := range resolvers {
+		revision, ok, err := resolver.ResolveBase(getenv)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", resolver.Name(), err)
+		}
+		if ok {
+			return revision, resolver.Name(), nil
+		}
+	}
+
+	v, err := r.openVCS()
+	if err != nil {
+		return "", "", err
+	}
+
+	revision, err := mergeBaseWithDefaultBranch(ctx, v)
+	if err != nil {
+		return "", "", err
+	}
+
+	return revision, "merge base with default branch", nil
+}
+
+func resolvePatrolBase(getenv Getenv) (string, bool, error) {
+	base := getenv("PATROL_BASE")
+	return base, base != "", nil
+}
+
+func resolveGitHubActions(getenv Getenv) (string, bool, error) {
+	if getenv("GITHUB_ACTIONS") != "true" {
+		return "", false, nil
+	}
+
+	var event struct {
+		Before      string `json:"before"`
+		PullRequest struct {
+			Base struct {
+				SHA string `json:"sha"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+
+	if path := getenv("GITHUB_EVENT_PATH"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, err
+		}
+		if err := json.Unmarshal(b, &event); err != nil {
+			return "", false, err
+		}
+	}
+
+	if event.PullRequest.Base.SHA != "" {
+		return event.PullRequest.Base.SHA, true, nil
+	}
+
+	if ref := getenv("GITHUB_BASE_REF"); ref != "" {
+		return "origin/" + ref, true, nil
+	}
+
+	if event.Before != "" && event.Before != zeroCommit {
+		return event.Before, true, nil
+	}
+
+	return "", false, nil
+}
+
+func resolveGitLabCI(getenv Getenv) (string, bool, error) {
+	if getenv("GITLAB_CI") != "true" {
+		return "", false, nil
+	}
+
+	if base := getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA"); base != "" {
+		return base, true, nil
+	}
+
+	if before := getenv("CI_COMMIT_BEFORE_SHA"); before != "" && before != zeroCommit {
+		return before, true, nil
+	}
+
+	return "", false, nil
+}
+
+func resolveDrone(getenv Getenv) (string, bool, error) {
+	if getenv("DRONE") != "true" {
+		return "", false, nil
+	}
+
+	if getenv("DRONE_PULL_REQUEST") != "" {
+		if target := getenv("DRONE_TARGET_BRANCH"); target != "" {
+			return "origin/" + target, true, nil
+		}
+	}
+
+	if before := getenv("DRONE_COMMIT_BEFORE"); before != "" && before != zeroCommit {
+		return before, true, nil
+	}
+
+	return "", false, nil
+}
+
+func resolveBuildkite(getenv Getenv) (string, bool, error) {
+	if getenv("BUILDKITE") != "true" {
+		return "", false, nil
+	}
+
+	pr := getenv("BUILDKITE_PULL_REQUEST")
+	if pr == "" || pr == "false" {
+		return "", false, nil
+	}
+
+	if base := getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH"); base != "" {
+		return "origin/" + base, true, nil
+	}
+
+	return "", false, nil
+}
+
+// mergeBaseWithDefaultBranch returns the best common ancestor of HEAD and
+// the default branch (as pointed to by origin/HEAD, or main or master).
+func mergeBaseWithDefaultBranch(ctx context.Context, v vcs) (string, error) {
+	head, err := v.resolveRevision(ctx, "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	branch, name, err := defaultBranch(ctx, v)
+	if err != nil {
+		return "", err
+	}
+
+	base, err := v.mergeBase(ctx, head, branch)
+	if err != nil {
+		return "", err
+	}
+
+	if base == "" {
+		return "", fmt.Errorf("no merge base found between HEAD and %s", name)
+	}
+
+	return base, nil
+}
+
+// defaultBranch returns the commit the default branch of the repo points to,
+// together with the short name of the branch.
+func defaultBranch(ctx context.Context, v vcs) (string, string, error) {
+	candidates := []plumbing.ReferenceName{
+		plumbing.NewRemoteHEADReferenceName("origin"),
+		plumbing.NewRemoteReferenceName("origin", "main"),
+		plumbing.NewRemoteReferenceName("origin", "master"),
+		plumbing.NewBranchReferenceName("main"),
+		plumbing.NewBranchReferenceName("master"),
+	}
+
+	for _, name := range candidates {
+		commit, err := v.resolveRevision(ctx, name.String())
+		if errors.Is(err, ErrRevisionNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return commit, name.Short(), nil
+	}
+
+	names := make([]string, len(candidates))
+	for i, name := range candidates {
+		names[i] = name.Short()
+	}
+
+	return "", "", fmt.Errorf("default branch not found, tried %s", strings.Join(names, ", "))
+}
@@ -0,0 +1,199 @@
+package patrol_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func fakeEnv(env map[string]string) patrol.Getenv {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestBaseResolvers(t *testing.T) {
+	event := filepath.Join(t.TempDir(), "event.json")
+	require.NoError(t, os.WriteFile(event, []byte(`{"before": "1111111111111111111111111111111111111111"}`), 0600))
+
+	prEvent := filepath.Join(t.TempDir(), "event.json")
+	require.NoError(t, os.WriteFile(prEvent, []byte(`{"pull_request": {"base": {"sha": "2222222222222222222222222222222222222222"}}}`), 0600))
+
+	tests := []struct {
+		name     string
+		resolver patrol.BaseResolver
+		env      map[string]string
+		expected string
+		ok       bool
+	}{
+		{
+			name:     "PATROL_BASE set",
+			resolver: patrol.PatrolBase,
+			env:      map[string]string{"PATROL_BASE": "origin/main"},
+			expected: "origin/main",
+			ok:       true,
+		},
+		{
+			name:     "PATROL_BASE not set",
+			resolver: patrol.PatrolBase,
+			env:      map[string]string{},
+		},
+		{
+			name:     "GitHub Actions push",
+			resolver: patrol.GitHubActions,
+			env:      map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_EVENT_PATH": event},
+			expected: "1111111111111111111111111111111111111111",
+			ok:       true,
+		},
+		{
+			name:     "GitHub Actions pull request",
+			resolver: patrol.GitHubActions,
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITHUB_EVENT_PATH": prEvent,
+				"GITHUB_BASE_REF":   "main",
+			},
+			expected: "2222222222222222222222222222222222222222",
+			ok:       true,
+		},
+		{
+			name:     "GitHub Actions pull request without event payload",
+			resolver: patrol.GitHubActions,
+			env:      map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_BASE_REF": "main"},
+			expected: "origin/main",
+			ok:       true,
+		},
+		{
+			name:     "not GitHub Actions",
+			resolver: patrol.GitHubActions,
+			env:      map[string]string{"GITHUB_BASE_REF": "main"},
+		},
+		{
+			name:     "GitLab merge request",
+			resolver: patrol.GitLabCI,
+			env: map[string]string{
+				"GITLAB_CI":                      "true",
+				"CI_MERGE_REQUEST_DIFF_BASE_SHA": "3333333333333333333333333333333333333333",
+				"CI_COMMIT_BEFORE_SHA":           "0000000000000000000000000000000000000000",
+			},
+			expected: "3333333333333333333333333333333333333333",
+			ok:       true,
+		},
+		{
+			name:     "GitLab new branch push",
+			resolver: patrol.GitLabCI,
+			env: map[string]string{
+				"GITLAB_CI":            "true",
+				"CI_COMMIT_BEFORE_SHA": "0000000000000000000000000000000000000000",
+			},
+		},
+		{
+			name:     "Drone pull request",
+			resolver: patrol.Drone,
+			env: map[string]string{
+				"DRONE":               "true",
+				"DRONE_PULL_REQUEST":  "42",
+				"DRONE_TARGET_BRANCH": "master",
+				"DRONE_COMMIT_BEFORE": "4444444444444444444444444444444444444444",
+			},
+			expected: "origin/master",
+			ok:       true,
+		},
+		{
+			name:     "Drone push",
+			resolver: patrol.Drone,
+			env: map[string]string{
+				"DRONE":               "true",
+				"DRONE_COMMIT_BEFORE": "4444444444444444444444444444444444444444",
+			},
+			expected: "4444444444444444444444444444444444444444",
+			ok:       true,
+		},
+		{
+			name:     "Buildkite pull request",
+			resolver: patrol.Buildkite,
+			env: map[string]string{
+				"BUILDKITE":                          "true",
+				"BUILDKITE_PULL_REQUEST":             "42",
+				"BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main",
+			},
+			expected: "origin/main",
+			ok:       true,
+		},
+		{
+			name:     "Buildkite push",
+			resolver: patrol.Buildkite,
+			env: map[string]string{
+				"BUILDKITE":              "true",
+				"BUILDKITE_PULL_REQUEST": "false",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revision, ok, err := test.resolver.ResolveBase(fakeEnv(test.env))
+			require.NoError(t, err)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, revision)
+		})
+	}
+}
+
+func TestResolveBase(t *testing.T) {
+	tmp := t.TempDir()
+	repo, err := git.PlainInit(tmp, false)
+	require.NoError(t, err)
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	commit := func(file, content string) plumbing.Hash {
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, file), []byte(content), 0600))
+		_, err := worktree.Add(file)
+		require.NoError(t, err)
+		hash, err := worktree.Commit(file, &git.CommitOptions{
+			Author: &object.Signature{Name: "patrol test", Email: "patrol@test.me", When: time.Now()},
+		})
+		require.NoError(t, err)
+		return hash
+	}
+
+	commit("go.mod", "module github.com/utilitywarehouse/resolvebase\n")
+	base := commit("a", "a")
+	require.NoError(t, worktree.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("feature"),
+		Create: true,
+	}))
+	commit("b", "b")
+
+	for _, backend := range []patrol.VCSBackend{patrol.VCSGoGit, patrol.VCSGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			r, err := patrol.NewRepo(tmp, patrol.VCS(backend))
+			require.NoError(t, err)
+
+			t.Run("resolver applies", func(t *testing.T) {
+				revision, source, err := r.ResolveBase(context.Background(), fakeEnv(map[string]string{"PATROL_BASE": "HEAD~1"}), nil)
+				require.NoError(t, err)
+				assert.Equal(t, "HEAD~1", revision)
+				assert.Equal(t, "PATROL_BASE", source)
+			})
+
+			t.Run("merge base with default branch", func(t *testing.T) {
+				revision, _, err := r.ResolveBase(context.Background(), fakeEnv(map[string]string{}), nil)
+				require.NoError(t, err)
+				assert.Equal(t, base.String(), revision)
+			})
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package patrol
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sourceExtensions are the extensions of the files other than .go files the
+// go tool compiles (or links) as part of a package, see go help c.
+var sourceExtensions = map[string]bool{
+	".c": true, ".h": true,
+	".cc": true, ".cpp": true, ".cxx": true, ".hh": true, ".hpp": true, ".hxx": true,
+	".m": true,
+	".s": true, ".S": true, ".sx": true,
+	".f": true, ".F": true, ".for": true, ".f90": true,
+	".swig": true, ".swigcxx": true,
+	".syso": true,
+}
+
+// isPackageSource returns true if the file with the given name (relative to
+// the repo root) is a .go file, or any other file the go tool compiles as
+// part of the package in its directory.
+func (r *Repo) isPackageSource(name string) bool {
+	if strings.HasSuffix(name, ".go") {
+		return true
+	}
+	return sourceExtensions[path.Ext(name)] && len(r.sources[path.Dir(name)]) > 0
+}
+
+// parseImports parses the imports of the .go file with the given name, and
+// its comments too if it might use cgo (see addCgoDirectives).
+func parseImports(fset *token.FileSet, name string, src []byte) (*ast.File, error) {
+	mode := parser.ImportsOnly
+	if bytes.Contains(src, []byte(`"C"`)) {
+		mode |= parser.ParseComments
+	}
+	return parser.ParseFile(fset, name, src, mode)
+}
+
+// addCgoDirectives adds to src the files and directories within the repo, and
+// the pkg-config packages, the #cgo directives in the preamble of file (found
+// in dir) refer to.
+func addCgoDirectives(src *sourcePackage, file *ast.File, dir string) {
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+
+		for _, spec := range d.Specs {
+			imp := spec.(*ast.ImportSpec)
+			if imp.Path.Value != strconv.Quote("C") {
+				continue
+			}
+
+			// the preamble is the comment right before import "C"
+			doc := imp.Doc
+			if doc == nil && len(d.Specs) == 1 {
+				doc = d.Doc
+			}
+			if doc == nil {
+				continue
+			}
+
+			for _, line := range strings.Split(doc.Text(), "\n") {
+				paths, packages := parseCgoDirective(line, dir)
+				src.cgo = addSorted(src.cgo, paths...)
+				src.pkgConfig = addSorted(src.pkgConfig, packages...)
+			}
+		}
+	}
+}
+
+// parseCgoDirective returns the files and directories within the repo, and
+// the pkg-config packages, the given line of the preamble of a .go file in
+// dir refers to, if it's a #cgo directive. Build constraints of directives
+// are ignored.
+func parseCgoDirective(line, dir string) ([]string, []string) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#cgo") {
+		return nil, nil
+	}
+
+	// #cgo [GOOS/GOARCH...] VERB: args
+	directive, args, ok := strings.Cut(line[len("#cgo"):], ":")
+	fields := strings.Fields(directive)
+	if !ok || len(fields) == 0 {
+		return nil, nil
+	}
+
+	if fields[len(fields)-1] == "pkg-config" {
+		var packages []string
+		for _, arg := range splitArgs(args) {
+			if !strings.HasPrefix(arg, "-") {
+				packages = append(packages, arg)
+			}
+		}
+		return nil, packages
+	}
+
+	var paths []string
+	for _, p := range flagPaths(splitArgs(args)) {
+		// relative paths are relative to the directory of the package, which
+		// the compiler runs in
+		if rest, ok := strings.CutPrefix(p, "${SRCDIR}"); ok {
+			p = "." + rest
+		}
+		if name, ok := repoPath(dir, p); ok {
+			paths = append(paths, name)
+		}
+	}
+	return paths, nil
+}
+
+// parsePkgConfig returns the files and directories within the repo the
+// pkg-config file with the given name (relative to the repo root) refers to
+// in its Cflags and Libs, as well as the file itself. Only paths relative to
+// ${pcfiledir} are considered, any other path being outside of the repo.
+func parsePkgConfig(name string, contents []byte) []string {
+	// stands for the directory of the file until paths are resolved
+	const pcfiledir = "\x00"
+
+	paths := []string{name}
+	vars := map[string]string{"pcfiledir": pcfiledir}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.IndexAny(line, "=:")
+		if strings.HasPrefix(line, "#") || i <= 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value := os.Expand(strings.TrimSpace(line[i+1:]), func(v string) string {
+			return vars[v]
+		})
+		if line[i] == '=' {
+			vars[key] = value
+			continue
+		}
+
+		switch key {
+		case "Cflags", "Cflags.private", "Libs", "Libs.private":
+			for _, p := range flagPaths(splitArgs(value)) {
+				rest, ok := strings.CutPrefix(p, pcfiledir)
+				if !ok {
+					continue
+				}
+				if p, ok := repoPath(path.Dir(name), "."+rest); ok {
+					paths = append(paths, p)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// addPkgConfig records the pkg-config file with the given name (relative to
+// the repo root), see parsePkgConfig.
+func (r *Repo) addPkgConfig(name string, contents []byte) {
+	pkg := strings.TrimSuffix(path.Base(name), ".pc")
+	r.pkgConfigs[pkg] = addSorted(r.pkgConfigs[pkg], parsePkgConfig(name, contents)...)
+}
+
+// flagPaths returns the paths in the given compiler or linker flags: the
+// arguments of include and library path flags, and the arguments that aren't
+// flags (e.g. object files or static libraries).
+func flagPaths(args []string) []string {
+	pathFlags := []string{"-I", "-L", "-F", "-isystem", "-iquote", "-idirafter", "-include"}
+
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			paths = append(paths, arg)
+			continue
+		}
+
+		for _, flag := range pathFlags {
+			if !strings.HasPrefix(arg, flag) {
+				continue
+			}
+			if arg != flag {
+				paths = append(paths, arg[len(flag):])
+			} else if i+1 < len(args) {
+				i++
+				paths = append(paths, args[i])
+			}
+			break
+		}
+	}
+	return paths
+}
+
+// splitArgs splits the arguments of a #cgo directive or pkg-config field,
+// removing quotes.
+func splitArgs(s string) []string {
+	args := strings.Fields(s)
+	for i, arg := range args {
+		args[i] = strings.Trim(arg, `"'`)
+	}
+	return args
+}
+
+// repoPath returns the name, relative to the repo root, of the path p found
+// in dir, if it's within the repo.
+func repoPath(dir, p string) (string, bool) {
+	if p == "" || path.IsAbs(p) || strings.Contains(p, "$") {
+		return "", false
+	}
+
+	name := path.Join(dir, p)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// cgoReferences returns the names of the packages referring to each file or
+// directory of the repo in their #cgo directives, directly or through
+// pkg-config files found in the repo.
+func (r *Repo) cgoReferences() map[string][]string {
+	refs := map[string][]string{}
+	for dir, sources := range r.sources {
+		for _, src := range sources {
+			names := append([]string{}, src.cgo...)
+			for _, pkg := range src.pkgConfig {
+				names = append(names, r.pkgConfigs[pkg]...)
+			}
+			for _, name := range names {
+				refs[name] = addSorted(refs[name], r.packageName(dir))
+			}
+		}
+	}
+	return refs
+}
+
+// flagCgoDependants flags as changed the packages referring to the file with
+// the given name, or to any of the directories it's in, according to refs
+// (see cgoReferences).
+func (r *Repo) flagCgoDependants(refs map[string][]string, name string) {
+	if len(refs) == 0 || name == "" {
+		return
+	}
+
+	for p := name; ; p = path.Dir(p) {
+		for _, pkgName := range refs[p] {
+			r.logf("%s changed, flagging %s (cgo)", name, pkgName)
+			r.flagPackageAsChanged(pkgName, ChangedAPI)
+		}
+		if p == "." {
+			return
+		}
+	}
+}
+
+// addSorted adds the values missing from list (sorted) to it, keeping it
+// sorted.
+func addSorted(list []string, values ...string) []string {
+	for _, v := range values {
+		i := sort.SearchStrings(list, v)
+		if i < len(list) && list[i] == v {
+			continue
+		}
+		list = append(list, "")
+		copy(list[i+1:], list[i:])
+		list[i] = v
+	}
+	return list
+}
@@ -0,0 +1,334 @@
+package patrol
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiagnosticKind is the kind of problem found in the graph of packages.
+type DiagnosticKind string
+
+const (
+	// DiagnosticCycle is an import cycle between packages within the repo.
+	DiagnosticCycle DiagnosticKind = "cycle"
+	// DiagnosticTestCycle is an import cycle closed by an external test
+	// package (e.g. package foo_test), which isn't part of the graph.
+	DiagnosticTestCycle DiagnosticKind = "test cycle"
+	// DiagnosticOrphan is a package within the repo, other than a command,
+	// that no other package imports.
+	DiagnosticOrphan DiagnosticKind = "orphan"
+	// DiagnosticMissingImport is an import of a package of the module (or of
+	// a module nested in the repo) that doesn't exist.
+	DiagnosticMissingImport DiagnosticKind = "missing import"
+)
+
+// Diagnostic is a problem found in the graph of packages, which might
+// explain unexpected changes being reported (or expected ones not being).
+type Diagnostic struct {
+	Kind DiagnosticKind
+
+	// Package is the name of the package the problem was found in.
+	Package string
+
+	// Path lists the packages of a cycle, starting and ending with Package.
+	Path []string
+
+	// Position of the import causing the problem, if any, with the file name
+	// relative to the root of the repository.
+	Position token.Position
+
+	// Message explains the problem and how it affects detected changes.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Position.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", d.Position, d.Kind, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Package, d.Kind, d.Message)
+}
+
+// Diagnose returns the structural problems found in the graph of packages
+// within the repo: import cycles (also the ones closed by external test
+// packages), packages nothing imports and imports of packages that don't
+// exist. Diagnostics are sorted by package.
+func (r *Repo) Diagnose() ([]Diagnostic, error) {
+	var diagnostics []Diagnostic
+
+	for _, cycle := range r.importCycles() {
+		diagnostics = append(diagnostics, Diagnostic{
+			Kind:    DiagnosticCycle,
+			Package: cycle[0],
+			Path:    cycle,
+			Message: fmt.Sprintf("import cycle %s: go can't build it, and a change to "+
+				"any of these packages is reported as a change to all of them",
+				strings.Join(cycle, " -> ")),
+		})
+	}
+
+	// packages imported by external test packages are used, even if the
+	// graph doesn't know it
+	testImported := map[string]bool{}
+
+	for _, pkg := range sortedPackages(r.Packages) {
+		// the go command ignores testdata directories
+		if !pkg.PartOfModule || pkg.Dir == "" || inTestdata(pkg.Dir) {
+			continue
+		}
+
+		imports := r.importPositions(pkg.Dir)
+
+		reported := map[string]bool{}
+		for _, imp := range imports {
+			if imp.external {
+				testImported[imp.path] = true
+			}
+			if reported[imp.path] {
+				continue
+			}
+
+			if d, ok := r.missingImport(pkg, imp); ok {
+				diagnostics = append(diagnostics, d)
+				reported[imp.path] = true
+				continue
+			}
+
+			if d, ok := selfImport(pkg, imp); ok {
+				diagnostics = append(diagnostics, d)
+				reported[imp.path] = true
+				continue
+			}
+
+			if !imp.external || imp.path == pkg.Name {
+				continue
+			}
+
+			// the external test package imports a package depending on the
+			// package it tests
+			path, err := r.ImportPath(imp.path, pkg.Name)
+			if err != nil || path == nil {
+				continue
+			}
+			cycle := append([]string{pkg.Name + "_test"}, path...)
+			diagnostics = append(diagnostics, Diagnostic{
+				Kind:     DiagnosticTestCycle,
+				Package:  pkg.Name,
+				Path:     cycle,
+				Position: imp.position,
+				Message: fmt.Sprintf("import cycle through external test package %s: "+
+					"external test packages aren't part of the graph, so a change to %s "+
+					"doesn't flag %s even though its tests depend on it",
+					strings.Join(cycle, " -> "), imp.path, pkg.Name),
+			})
+			reported[imp.path] = true
+		}
+	}
+
+	for _, pkg := range sortedPackages(r.Packages) {
+		if !pkg.PartOfModule || pkg.Dir == "" || inTestdata(pkg.Dir) || pkg.Main ||
+			len(pkg.Dependants) > 0 || testImported[pkg.Name] || r.onlyTests(pkg.Dir) {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Kind:    DiagnosticOrphan,
+			Package: pkg.Name,
+			Message: fmt.Sprintf("%s isn't imported by any package and isn't a command: "+
+				"its changes are reported but don't affect anything else", pkg.Name),
+		})
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Package < diagnostics[j].Package
+	})
+
+	return diagnostics, nil
+}
+
+// missingImport returns a diagnostic if imp, found in pkg, is an import of a
+// package within the repo that doesn't exist.
+func (r *Repo) missingImport(pkg *Package, imp importPosition) (Diagnostic, bool) {
+	if !r.OwnsPackage(imp.path) {
+		return Diagnostic{}, false
+	}
+	if imported, exists := r.Packages[imp.path]; exists && imported.Dir != "" {
+		return Diagnostic{}, false
+	}
+
+	problem := "which doesn't exist"
+	if dir, ok := r.moduleDir(imp.path); ok {
+		info, err := os.Stat(filepath.Join(r.path, filepath.FromSlash(dir)))
+		if err == nil && info.IsDir() {
+			problem = fmt.Sprintf("but %s has no go files", dir)
+		} else {
+			problem = fmt.Sprintf("but there's no %s directory", dir)
+		}
+	}
+
+	return Diagnostic{
+		Kind:     DiagnosticMissingImport,
+		Package:  pkg.Name,
+		Position: imp.position,
+		Message: fmt.Sprintf("%s imports %s, %s: changes to it can't be detected",
+			pkg.Name, imp.path, problem),
+	}, true
+}
+
+// moduleDir returns the directory, relative to the root of the repo, the
+// package with the given name would be in if it was part of the module or of
+// a module nested in the repo.
+func (r *Repo) moduleDir(name string) (string, bool) {
+	modules := map[string]string{".": r.ModuleName()}
+	for dir, modulePath := range r.modules {
+		modules[dir] = modulePath
+	}
+
+	var dir, modulePath string
+	for d, p := range modules {
+		if name != p && !strings.HasPrefix(name, p+"/") {
+			continue
+		}
+		// nested modules take precedence
+		if len(p) > len(modulePath) {
+			dir, modulePath = d, p
+		}
+	}
+	if modulePath == "" {
+		return "", false
+	}
+
+	return path.Join(dir, strings.TrimPrefix(name, modulePath)), true
+}
+
+// onlyTests returns true if all packages found in dir are external test
+// packages.
+func (r *Repo) onlyTests(dir string) bool {
+	for _, src := range r.sources[dir] {
+		if !strings.HasSuffix(src.name, "_test") {
+			return false
+		}
+	}
+	return len(r.sources[dir]) > 0
+}
+
+// importCycles returns the import cycles between packages within the repo,
+// one for each set of packages importing each other, starting and ending with
+// the first package of the set (by name).
+func (r *Repo) importCycles() [][]string {
+	// Tarjan's strongly connected components
+	index := map[*Package]int{}
+	lowlink := map[*Package]int{}
+	onStack := map[*Package]bool{}
+	var stack []*Package
+	var components [][]*Package
+
+	var visit func(pkg *Package)
+	visit = func(pkg *Package) {
+		index[pkg] = len(index)
+		lowlink[pkg] = index[pkg]
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+
+		for _, imp := range pkg.Imports {
+			dependency := imp.Package
+			if !dependency.PartOfModule {
+				continue
+			}
+			if _, visited := index[dependency]; !visited {
+				visit(dependency)
+				lowlink[pkg] = min(lowlink[pkg], lowlink[dependency])
+			} else if onStack[dependency] {
+				lowlink[pkg] = min(lowlink[pkg], index[dependency])
+			}
+		}
+
+		if lowlink[pkg] == index[pkg] {
+			var component []*Package
+			for {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[p] = false
+				component = append(component, p)
+				if p == pkg {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, pkg := range sortedPackages(r.Packages) {
+		if _, visited := index[pkg]; !visited && pkg.PartOfModule {
+			visit(pkg)
+		}
+	}
+
+	var cycles [][]string
+	for _, component := range components {
+		members := map[string]*Package{}
+		for _, pkg := range component {
+			members[pkg.Name] = pkg
+		}
+
+		if len(component) == 1 {
+			// packages importing themselves aren't part of the graph, see
+			// selfImport
+			continue
+		}
+		cycles = append(cycles, cyclePath(sortedPackages(members)[0], members))
+	}
+
+	return cycles
+}
+
+// selfImport returns a diagnostic if imp, found in pkg, is an import of pkg
+// itself. The graph doesn't record such imports.
+func selfImport(pkg *Package, imp importPosition) (Diagnostic, bool) {
+	if imp.external || imp.path != pkg.Name {
+		return Diagnostic{}, false
+	}
+
+	cycle := []string{pkg.Name, pkg.Name}
+	return Diagnostic{
+		Kind:     DiagnosticCycle,
+		Package:  pkg.Name,
+		Path:     cycle,
+		Position: imp.position,
+		Message:  fmt.Sprintf("import cycle %s: go can't build it", strings.Join(cycle, " -> ")),
+	}, true
+}
+
+// cyclePath returns one of the shortest import cycles from pkg back to
+// itself, going only through the given packages.
+func cyclePath(pkg *Package, members map[string]*Package) []string {
+	previous := map[*Package]*Package{}
+	queue := []*Package{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, imp := range p.Imports {
+			next := imp.Package
+			if members[next.Name] != next {
+				continue
+			}
+			if next == pkg {
+				path := []string{pkg.Name}
+				for q := p; q != pkg; q = previous[q] {
+					path = append([]string{q.Name}, path...)
+				}
+				return append([]string{pkg.Name}, path...)
+			}
+			if _, visited := previous[next]; visited {
+				continue
+			}
+			previous[next] = p
+			queue = append(queue, next)
+		}
+	}
+	return []string{pkg.Name}
+}
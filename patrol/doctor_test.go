@@ -0,0 +1,48 @@
+package patrol_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestDiagnose(t *testing.T) {
+	tmp, _ := newTestRepo(t, "testdata/doctor/commits/1")
+
+	repo, err := patrol.NewRepo(tmp)
+	require.NoError(t, err)
+
+	diagnostics, err := repo.Diagnose()
+	require.NoError(t, err)
+
+	var result []string
+	for _, d := range diagnostics {
+		result = append(result, d.String())
+	}
+
+	assert.Equal(t, []string{
+		"main.go:6:2: missing import: github.com/utilitywarehouse/doctor imports " +
+			"github.com/utilitywarehouse/doctor/pkg/empty, but pkg/empty has no go files: " +
+			"changes to it can't be detected",
+		"main.go:7:2: missing import: github.com/utilitywarehouse/doctor imports " +
+			"github.com/utilitywarehouse/doctor/pkg/missing, but there's no pkg/missing directory: " +
+			"changes to it can't be detected",
+		"github.com/utilitywarehouse/doctor/pkg/a: cycle: import cycle " +
+			"github.com/utilitywarehouse/doctor/pkg/a -> github.com/utilitywarehouse/doctor/pkg/b -> " +
+			"github.com/utilitywarehouse/doctor/pkg/a: go can't build it, and a change to any of " +
+			"these packages is reported as a change to all of them",
+		"pkg/c/c_test.go:6:2: test cycle: import cycle through external test package " +
+			"github.com/utilitywarehouse/doctor/pkg/c_test -> github.com/utilitywarehouse/doctor/pkg/d -> " +
+			"github.com/utilitywarehouse/doctor/pkg/c: external test packages aren't part of the graph, " +
+			"so a change to github.com/utilitywarehouse/doctor/pkg/d doesn't flag " +
+			"github.com/utilitywarehouse/doctor/pkg/c even though its tests depend on it",
+		"github.com/utilitywarehouse/doctor/pkg/orphan: orphan: github.com/utilitywarehouse/doctor/pkg/orphan " +
+			"isn't imported by any package and isn't a command: its changes are reported but don't " +
+			"affect anything else",
+		"pkg/self/self.go:3:8: cycle: import cycle github.com/utilitywarehouse/doctor/pkg/self -> " +
+			"github.com/utilitywarehouse/doctor/pkg/self: go can't build it",
+	}, result)
+}
@@ -0,0 +1,65 @@
+package patrol
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+var (
+	// ErrRevisionNotFound is returned when a revision, or any of the objects
+	// needed from it, can't be found (e.g. in shallow clones).
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrGoModNotFound is returned when there's no go.mod file at the root of
+	// the repo.
+	ErrGoModNotFound = errors.New("go.mod not found")
+
+	// ErrInvalidBaseGoMod is returned when the go.mod file at the base
+	// revision is missing or can't be parsed (in which case the error is also
+	// a *ParseError).
+	ErrInvalidBaseGoMod = errors.New("go.mod at base revision is missing or invalid")
+)
+
+// ParseError is returned when a .go or go.mod file can't be parsed.
+type ParseError struct {
+	// Path of the file, relative to the root of the repo and slash
+	// separated.
+	Path string
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns a *ParseError for the file with the given name, or adds
+// it to r.Warnings and returns nil if r continues on parse errors.
+func (r *Repo) parseError(name string, err error) error {
+	parseErr := &ParseError{Path: name, Err: err}
+	if r.continueOnParseErrors {
+		r.Warnings = append(r.Warnings, parseErr)
+		return nil
+	}
+	return parseErr
+}
+
+// isNotFound returns true if err is caused by a missing reference or object.
+func isNotFound(err error) bool {
+	return errors.Is(err, plumbing.ErrReferenceNotFound) || errors.Is(err, plumbing.ErrObjectNotFound)
+}
+
+// revisionNotFound wraps err with the given revision, and with
+// ErrRevisionNotFound if err is caused by a missing reference or object.
+func revisionNotFound(revision string, err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("%s: %w: %w", revision, ErrRevisionNotFound, err)
+	}
+	return fmt.Errorf("%s: %w", revision, err)
+}
@@ -0,0 +1,67 @@
+package patrol_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("go.mod not found", func(t *testing.T) {
+		_, err := patrol.NewRepo(t.TempDir())
+		assert.ErrorIs(t, err, patrol.ErrGoModNotFound)
+	})
+
+	t.Run("revision not found", func(t *testing.T) {
+		tmp, commits := newTestRepo(t, "testdata/internalchange/commits/1")
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		_, err = repo.ChangesFrom("not-fetched", false)
+		assert.ErrorIs(t, err, patrol.ErrRevisionNotFound)
+
+		_, err = repo.Log("not-fetched", commits[0], true, false)
+		assert.ErrorIs(t, err, patrol.ErrRevisionNotFound)
+	})
+
+	t.Run("invalid go.mod at base revision", func(t *testing.T) {
+		tmp, commits := newTestRepo(t,
+			"testdata/invalidgomod/commits/1",
+			"testdata/invalidgomod/commits/2",
+		)
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		_, err = repo.ChangesFrom(commits[0], false)
+		assert.ErrorIs(t, err, patrol.ErrInvalidBaseGoMod)
+
+		var parseErr *patrol.ParseError
+		require.ErrorAs(t, err, &parseErr)
+		assert.Equal(t, "go.mod", parseErr.Path)
+	})
+
+	t.Run("unparsable file", func(t *testing.T) {
+		tmp, _ := newTestRepo(t, "testdata/internalchange/commits/1")
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "pkg", "foo", "broken.go"),
+			[]byte("package foo\n\nimport (\n"), 0o644))
+
+		_, err := patrol.NewRepo(tmp)
+		var parseErr *patrol.ParseError
+		require.ErrorAs(t, err, &parseErr)
+		assert.Equal(t, "pkg/foo/broken.go", parseErr.Path)
+
+		repo, err := patrol.NewRepo(tmp, patrol.ContinueOnParseErrors())
+		require.NoError(t, err)
+		require.Len(t, repo.Warnings, 1)
+		require.ErrorAs(t, repo.Warnings[0], &parseErr)
+		assert.Equal(t, "pkg/foo/broken.go", parseErr.Path)
+		assert.Contains(t, repo.Packages, "github.com/utilitywarehouse/internalchange/pkg/foo")
+	})
+}
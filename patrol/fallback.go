@@ -0,0 +1,55 @@
+package patrol
+
+import (
+	"errors"
+)
+
+// MissingBasePolicy decides what ChangesFrom does when changes can't be
+// detected because the base revision (or its go.mod file) isn't available.
+type MissingBasePolicy string
+
+const (
+	// MissingBaseError returns an error. This is the default policy.
+	MissingBaseError MissingBasePolicy = "error"
+	// MissingBaseAll reports every package within the module as changed.
+	MissingBaseAll MissingBasePolicy = "all"
+	// MissingBaseNone reports the changes that could be detected, if any.
+	MissingBaseNone MissingBasePolicy = "none"
+)
+
+// applyMissingBasePolicy handles err according to the OnMissingBase policy, if err
+// was caused by a missing base revision or an invalid go.mod file at the
+// base revision. Any other error is returned as is.
+func (r *Repo) applyMissingBasePolicy(err error) error {
+	var reason string
+	switch {
+	case errors.Is(err, ErrRevisionNotFound):
+		reason = "base revision not found"
+	case errors.Is(err, ErrInvalidBaseGoMod):
+		reason = ErrInvalidBaseGoMod.Error()
+	default:
+		return err
+	}
+
+	switch r.onMissingBase {
+	case MissingBaseAll:
+		for _, pkg := range r.Packages {
+			if !pkg.PartOfModule {
+				continue
+			}
+			// packages already flagged are reported for the same reason as
+			// any other, their changes can't be trusted to be complete
+			pkg.Reason = reason
+			if !pkg.Changed {
+				pkg.Changed = true
+				pkg.ChangeKind = ChangedAPI
+				pkg.direct = true
+			}
+		}
+		return nil
+	case MissingBaseNone:
+		return nil
+	default:
+		return err
+	}
+}
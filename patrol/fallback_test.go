@@ -0,0 +1,66 @@
+package patrol_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestMissingBase(t *testing.T) {
+	path, _ := newTestRepo(t, "testdata/internalchange/commits/1")
+
+	tests := []struct {
+		policy   patrol.MissingBasePolicy
+		expected []string
+		err      bool
+	}{
+		{policy: "", err: true},
+		{policy: patrol.MissingBaseError, err: true},
+		{policy: patrol.MissingBaseNone},
+		{
+			policy: patrol.MissingBaseAll,
+			expected: []string{
+				"github.com/utilitywarehouse/internalchange/internal/bar",
+				"github.com/utilitywarehouse/internalchange/pkg/foo",
+				"github.com/utilitywarehouse/internalchange/pkg/cat",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			r, err := patrol.NewRepo(path, patrol.OnMissingBase(test.policy))
+			require.NoError(t, err)
+
+			changes, err := r.ChangesFrom("not-fetched", false)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.expected, changes)
+			for _, c := range changes {
+				assert.Equal(t, "base revision not found", r.Packages[c].Reason)
+			}
+		})
+	}
+}
+
+func TestMissingBaseReasonOnChangedPackages(t *testing.T) {
+	r, err := patrol.NewRepo("testdata/internalchange/commits/1", patrol.OnMissingBase(patrol.MissingBaseAll))
+	require.NoError(t, err)
+
+	// pkg/foo is flagged before the base go.mod turns out to be invalid
+	changes, err := r.ChangesFromFiles(context.Background(), []string{"pkg/foo/foo.go"}, []byte("module"))
+	require.NoError(t, err)
+
+	require.Len(t, changes, 3)
+	for _, c := range changes {
+		assert.Equal(t, patrol.ErrInvalidBaseGoMod.Error(), r.Packages[c].Reason, c)
+	}
+}
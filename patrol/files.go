@@ -0,0 +1,64 @@
+package patrol
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ReadChangedFiles reads a list of changed files, as printed by git diff
+// --name-only (one per line) or with -z (NUL separated). Names are relative
+// to the root of the repo. Surrounding whitespace is trimmed from names read
+// one per line, but names read with -z are taken as they are.
+func ReadChangedFiles(r io.Reader) ([]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sep, trim := []byte("\n"), strings.TrimSpace
+	if bytes.IndexByte(b, 0) >= 0 {
+		sep, trim = []byte{0}, func(name string) string { return name }
+	}
+
+	var names []string
+	for _, field := range bytes.Split(b, sep) {
+		name := trim(string(field))
+		if name == "" {
+			continue
+		}
+		names = append(names, path.Clean(filepath.ToSlash(name)))
+	}
+	return names, nil
+}
+
+// ChangesFromFiles returns a list of packages (within the repo) that have
+// been affected by changes to the given files, without reading anything from
+// git: files are read from the working tree if needed. If oldGoMod (the
+// contents of the go.mod file before the changes) isn't nil, changes to the
+// required modules are detected too.
+//
+// SemanticDiff, APISurface and SymbolLevel don't apply, as the previous
+// contents of the files aren't known, nor do Worktree, MergeBase and Target.
+func (r *Repo) ChangesFromFiles(ctx context.Context, files []string, oldGoMod []byte) ([]string, error) {
+	if err := r.flagChangedFiles(ctx, files, r.allFiles); err != nil {
+		return nil, err
+	}
+
+	if oldGoMod == nil {
+		return r.changedOwnedPackages(), nil
+	}
+
+	mod, err := r.parseBaseGoMod(oldGoMod)
+	if err == nil {
+		err = r.detectGoModulesChanges(mod)
+	}
+	if err = r.applyMissingBasePolicy(err); err != nil {
+		return nil, err
+	}
+
+	return r.changedOwnedPackages(), nil
+}
@@ -0,0 +1,90 @@
+package patrol_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestReadChangedFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "newline separated",
+			input:    "pkg/foo/foo.go\r\n./pkg/baz/baz.go\n\ngo.mod\n",
+			expected: []string{"pkg/foo/foo.go", "pkg/baz/baz.go", "go.mod"},
+		},
+		{
+			name:     "NUL separated",
+			input:    "pkg/foo/foo.go\x00with space/file name.go\x00",
+			expected: []string{"pkg/foo/foo.go", "with space/file name.go"},
+		},
+		{
+			name:     "NUL separated with surrounding spaces",
+			input:    " pkg/foo/foo.go\x00pkg/bar/bar.go \x00",
+			expected: []string{" pkg/foo/foo.go", "pkg/bar/bar.go "},
+		},
+		{
+			name:     "empty",
+			input:    "",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := patrol.ReadChangedFiles(strings.NewReader(test.input))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, files)
+		})
+	}
+}
+
+func TestChangesFromFiles(t *testing.T) {
+	const module = "github.com/utilitywarehouse/options"
+
+	t.Run("packages", func(t *testing.T) {
+		repo, err := patrol.NewRepo("testdata/options/commits/1", patrol.Tests(patrol.TestsIgnore))
+		require.NoError(t, err)
+
+		changes, err := repo.ChangesFromFiles(context.Background(), []string{
+			"pkg/foo/foo.go",
+			"pkg/baz/baz_test.go",
+			"README.md",
+		}, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{module + "/cmd/app", module + "/pkg/foo"}, changes)
+	})
+
+	t.Run("go.mod", func(t *testing.T) {
+		oldGoMod, err := os.ReadFile("testdata/modules/commits/1/go.mod")
+		require.NoError(t, err)
+
+		repo, err := patrol.NewRepo("testdata/modules/commits/2")
+		require.NoError(t, err)
+
+		changes, err := repo.ChangesFromFiles(context.Background(), []string{"go.mod", "go.sum"}, oldGoMod)
+		require.NoError(t, err)
+		assert.Equal(t, expectedChanges(t, "testdata/modules/commits/2"), changes)
+	})
+
+	t.Run("invalid go.mod", func(t *testing.T) {
+		repo, err := patrol.NewRepo("testdata/modules/commits/2")
+		require.NoError(t, err)
+
+		_, err = repo.ChangesFromFiles(context.Background(), nil, []byte("module"))
+		assert.ErrorIs(t, err, patrol.ErrInvalidBaseGoMod)
+
+		var parseErr *patrol.ParseError
+		assert.ErrorAs(t, err, &parseErr)
+	})
+}
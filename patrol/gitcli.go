@@ -0,0 +1,252 @@
+package patrol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitCLI is the vcs implemented by running the git command.
+type gitCLI struct {
+	// dir is the root of the repo, where git is run
+	dir string
+
+	// hashes of the commits revisions were already resolved to
+	revisions map[string]string
+
+	// submodules already opened (nil if not checked out), by directory
+	submodules map[string]*gitCLI
+}
+
+// emptyTree is the hash of the tree with no entries, which git always knows.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// gitlinkMode is the mode of tree entries pointing to a submodule commit.
+const gitlinkMode = "160000"
+
+// newGitCLI returns a gitCLI for the repo at dir, if git can be found.
+func newGitCLI(dir string) (*gitCLI, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, err
+	}
+	return gitCLIAt(dir), nil
+}
+
+// gitCLIAt returns a gitCLI for the repo at dir.
+func gitCLIAt(dir string) *gitCLI {
+	return &gitCLI{dir: dir, revisions: map[string]string{}, submodules: map[string]*gitCLI{}}
+}
+
+// run runs git with the given arguments and returns its output. git is
+// killed once ctx is done.
+func (g *gitCLI) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// exists returns true if the object named (e.g. commit:path) exists.
+func (g *gitCLI) exists(ctx context.Context, object string) bool {
+	_, err := g.run(ctx, "cat-file", "-e", object)
+	return err == nil
+}
+
+func (g *gitCLI) resolveRevision(ctx context.Context, revision string) (string, error) {
+	if hash, ok := g.revisions[revision]; ok {
+		return hash, nil
+	}
+
+	out, err := g.run(ctx, "rev-parse", "--verify", "--quiet", "--end-of-options", revision+"^{commit}")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", fmt.Errorf("%s: %w", revision, ErrRevisionNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hash := strings.TrimSpace(string(out))
+	g.revisions[revision] = hash
+	return hash, nil
+}
+
+func (g *gitCLI) changedFiles(ctx context.Context, then, now string) ([]fileChange, error) {
+	if then == "" {
+		then = emptyTree
+	}
+	if now == "" {
+		now = emptyTree
+	}
+
+	out, err := g.run(ctx, "diff", "--no-renames", "--no-ext-diff", "--raw", "--no-abbrev", "-z", then, now, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	// each change is its modes, hashes and status followed by the name of the
+	// file
+	fields := splitNul(out)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("git diff: unexpected output")
+	}
+
+	changes := make([]fileChange, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		// :<then mode> SP <now mode> SP <then hash> SP <now hash> SP <status>
+		info, name := strings.Fields(strings.TrimPrefix(fields[i], ":")), fields[i+1]
+		if len(info) != 5 {
+			return nil, fmt.Errorf("git diff: unexpected output %q", fields[i])
+		}
+
+		var file, link fileChange
+		switch {
+		case info[4] == "D":
+		case info[1] == gitlinkMode:
+			link.now, link.nowLink = name, info[3]
+		default:
+			file.now = name
+		}
+		switch {
+		case info[4] == "A":
+		case info[0] == gitlinkMode:
+			link.then, link.thenLink = name, info[2]
+		default:
+			file.then = name
+		}
+
+		for _, c := range []fileChange{file, link} {
+			if c.now != "" || c.then != "" {
+				changes = append(changes, c)
+			}
+		}
+	}
+	return changes, nil
+}
+
+func (g *gitCLI) readFile(ctx context.Context, commit, name string) ([]byte, error) {
+	out, err := g.run(ctx, "cat-file", "blob", commit+":"+name)
+	if err != nil {
+		if g.exists(ctx, commit) && !g.exists(ctx, commit+":"+name) {
+			return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (g *gitCLI) readDir(ctx context.Context, commit, dir string) ([]string, error) {
+	args := []string{"ls-tree", "-z", commit}
+	if dir != "." {
+		args = append(args, "--", dir+"/")
+	}
+
+	out, err := g.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range splitNul(out) {
+		// <mode> SP <type> SP <object> TAB <file>
+		info, name, ok := strings.Cut(entry, "\t")
+		if !ok {
+			return nil, fmt.Errorf("git ls-tree: unexpected output %q", entry)
+		}
+		if mode, _, _ := strings.Cut(info, " "); mode == "100644" || mode == "100755" {
+			names = append(names, path.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (g *gitCLI) mergeBase(ctx context.Context, a, b string) (string, error) {
+	out, err := g.run(ctx, "merge-base", a, b)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// no common ancestor
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g *gitCLI) worktreeChanges(ctx context.Context) ([]string, error) {
+	out, err := g.run(ctx, "status", "--porcelain=v1", "-z", "--untracked-files=all", "--no-renames")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range splitNul(out) {
+		// XY SP <file>
+		if len(entry) < 4 {
+			return nil, fmt.Errorf("git status: unexpected output %q", entry)
+		}
+		names = append(names, entry[3:])
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (g *gitCLI) gitlink(ctx context.Context, commit, dir string) (string, error) {
+	out, err := g.run(ctx, "ls-tree", "-z", commit, "--", dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range splitNul(out) {
+		// <mode> SP <type> SP <object> TAB <file>
+		info, name, _ := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if name == dir && len(fields) == 3 && fields[0] == gitlinkMode {
+			return fields[2], nil
+		}
+	}
+	return "", nil
+}
+
+func (g *gitCLI) submodule(dir string) (vcs, error) {
+	sub, ok := g.submodules[dir]
+	if !ok {
+		subDir := filepath.Join(g.dir, filepath.FromSlash(dir))
+		if _, err := os.Stat(filepath.Join(subDir, ".git")); err == nil {
+			sub = gitCLIAt(subDir)
+		}
+		g.submodules[dir] = sub
+	}
+
+	if sub == nil {
+		return nil, nil
+	}
+	return sub, nil
+}
+
+// splitNul splits the NUL separated (and terminated) fields in out.
+func splitNul(out []byte) []string {
+	s := strings.TrimSuffix(string(out), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
@@ -0,0 +1,164 @@
+package patrol
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DependantCount is the number of packages depending on a package.
+type DependantCount struct {
+	Package *Package
+
+	// Direct is the number of packages importing the package.
+	Direct int
+
+	// Transitive is the number of packages depending on the package, directly
+	// or through other packages.
+	Transitive int
+}
+
+// Package returns the package with the given name, which can also be a
+// directory relative to the root of the repository (e.g. ./pkg/foo). Any
+// package imported within the repository can be found, including standard
+// library packages and packages of external modules.
+func (r *Repo) Package(name string) (*Package, error) {
+	pkg, exists := r.Packages[r.resolvePattern(name)]
+	if !exists {
+		return nil, fmt.Errorf("package %s not found", name)
+	}
+	return pkg, nil
+}
+
+// DirectDependants returns the packages importing the package with the given
+// name (see Package), sorted by name.
+func (r *Repo) DirectDependants(name string) ([]*Package, error) {
+	pkg, err := r.Package(name)
+	if err != nil {
+		return nil, err
+	}
+
+	unique := map[string]*Package{}
+	for _, d := range pkg.Dependants {
+		unique[d.Name] = d
+	}
+
+	return sortedPackages(unique), nil
+}
+
+// TransitiveDependants returns the packages depending on the package with the
+// given name (see Package), directly or through other packages, sorted by
+// name.
+func (r *Repo) TransitiveDependants(name string) ([]*Package, error) {
+	pkg, err := r.Package(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedPackages(transitiveDependants(pkg)), nil
+}
+
+// DependantCounts returns the number of direct and transitive dependants of
+// every package, sorted by number of transitive dependants (most first).
+func (r *Repo) DependantCounts() []DependantCount {
+	counts := make([]DependantCount, 0, len(r.Packages))
+	for _, pkg := range r.Packages {
+		direct := map[string]bool{}
+		for _, d := range pkg.Dependants {
+			direct[d.Name] = true
+		}
+
+		counts = append(counts, DependantCount{
+			Package:    pkg,
+			Direct:     len(direct),
+			Transitive: len(transitiveDependants(pkg)),
+		})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Transitive != b.Transitive {
+			return a.Transitive > b.Transitive
+		}
+		if a.Direct != b.Direct {
+			return a.Direct > b.Direct
+		}
+		return a.Package.Name < b.Package.Name
+	})
+
+	return counts
+}
+
+// ImportPath returns one of the shortest chains of imports from the package
+// from to the package to (both as in Package), e.g.: [from, a, b, to] if from
+// imports a, which imports b, which imports to. It returns nil if from
+// doesn't depend on to.
+func (r *Repo) ImportPath(from, to string) ([]string, error) {
+	fromPkg, err := r.Package(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toPkg, err := r.Package(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// walk the dependants of to until from is found, keeping track of the
+	// package each dependant was reached from
+	next := map[string]string{toPkg.Name: ""}
+	queue := []*Package{toPkg}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		if pkg == fromPkg {
+			var path []string
+			for name := fromPkg.Name; name != ""; name = next[name] {
+				path = append(path, name)
+			}
+			return path, nil
+		}
+
+		for _, d := range pkg.Dependants {
+			if _, visited := next[d.Name]; visited {
+				continue
+			}
+			next[d.Name] = pkg.Name
+			queue = append(queue, d)
+		}
+	}
+
+	return nil, nil
+}
+
+// transitiveDependants returns the packages depending on pkg, directly or
+// through other packages, by name.
+func transitiveDependants(pkg *Package) map[string]*Package {
+	dependants := map[string]*Package{}
+	queue := []*Package{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, d := range p.Dependants {
+			if _, visited := dependants[d.Name]; visited || d == pkg {
+				continue
+			}
+			dependants[d.Name] = d
+			queue = append(queue, d)
+		}
+	}
+	return dependants
+}
+
+// sortedPackages returns the given packages sorted by name.
+func sortedPackages(pkgs map[string]*Package) []*Package {
+	result := make([]*Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		result = append(result, pkg)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,71 @@
+package patrol_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func packageNames(pkgs []*patrol.Package) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+	return names
+}
+
+func TestGraph(t *testing.T) {
+	repo, err := patrol.NewRepo("testdata/apisurface/commits/1")
+	require.NoError(t, err)
+
+	t.Run("direct dependants", func(t *testing.T) {
+		dependants, err := repo.DirectDependants("./pkg/foo")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com/utilitywarehouse/apisurface/pkg/bar"}, packageNames(dependants))
+	})
+
+	t.Run("transitive dependants", func(t *testing.T) {
+		dependants, err := repo.TransitiveDependants("github.com/utilitywarehouse/apisurface/pkg/foo")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"github.com/utilitywarehouse/apisurface/cmd/app",
+			"github.com/utilitywarehouse/apisurface/pkg/bar",
+		}, packageNames(dependants))
+	})
+
+	t.Run("standard library", func(t *testing.T) {
+		dependants, err := repo.TransitiveDependants("fmt")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com/utilitywarehouse/apisurface/cmd/app"}, packageNames(dependants))
+	})
+
+	t.Run("unknown package", func(t *testing.T) {
+		_, err := repo.TransitiveDependants("./pkg/baz")
+		assert.Error(t, err)
+	})
+
+	t.Run("dependant counts", func(t *testing.T) {
+		counts := repo.DependantCounts()
+		require.NotEmpty(t, counts)
+		assert.Equal(t, "github.com/utilitywarehouse/apisurface/pkg/foo", counts[0].Package.Name)
+		assert.Equal(t, 1, counts[0].Direct)
+		assert.Equal(t, 2, counts[0].Transitive)
+	})
+
+	t.Run("import path", func(t *testing.T) {
+		path, err := repo.ImportPath("./cmd/app", "./pkg/foo")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"github.com/utilitywarehouse/apisurface/cmd/app",
+			"github.com/utilitywarehouse/apisurface/pkg/bar",
+			"github.com/utilitywarehouse/apisurface/pkg/foo",
+		}, path)
+
+		path, err = repo.ImportPath("./pkg/foo", "./cmd/app")
+		require.NoError(t, err)
+		assert.Nil(t, path)
+	})
+}
@@ -0,0 +1,136 @@
+package patrol
+
+import (
+	"sort"
+	"strings"
+)
+
+// ImportKind classifies imported packages by where they come from.
+type ImportKind int
+
+const (
+	// ImportStandard is a package of the standard library.
+	ImportStandard ImportKind = iota
+	// ImportModule is a package within the repo, part of the module or of a
+	// module nested in the repo.
+	ImportModule
+	// ImportVendored is a package found in the vendor directory.
+	ImportVendored
+	// ImportExternal is a package of another module, required in go.mod (or
+	// missing from it).
+	ImportExternal
+)
+
+func (k ImportKind) String() string {
+	switch k {
+	case ImportStandard:
+		return "standard"
+	case ImportModule:
+		return "module"
+	case ImportVendored:
+		return "vendored"
+	default:
+		return "external"
+	}
+}
+
+// Import is a package imported by another package.
+type Import struct {
+	Package *Package
+	Kind    ImportKind
+
+	// Module and Version are the path and the version (as required in go.mod)
+	// of the module providing vendored and external packages. They're empty
+	// if the module isn't required in go.mod.
+	Module  string
+	Version string
+}
+
+// addImport adds dependency to the imports of pkg, unless it's already there.
+func (pkg *Package) addImport(dependency *Package) {
+	for _, imp := range pkg.Imports {
+		if imp.Package == dependency {
+			return
+		}
+	}
+	pkg.Imports = append(pkg.Imports, Import{Package: dependency})
+}
+
+// classifyImport works out the kind of the imported package, and the module
+// providing it.
+func (r *Repo) classifyImport(imp *Import) {
+	name := imp.Package.Name
+
+	switch {
+	case strings.HasPrefix(imp.Package.Dir, "vendor/"):
+		imp.Kind = ImportVendored
+	case r.OwnsPackage(name):
+		imp.Kind = ImportModule
+		return
+	case isStandardPackage(name):
+		imp.Kind = ImportStandard
+		return
+	default:
+		imp.Kind = ImportExternal
+	}
+
+	if module, ok := r.externalModule(name); ok {
+		imp.Module = module
+		imp.Version = requiredVersion(r.Module, module)
+	}
+}
+
+// isStandardPackage returns true if the import path belongs to the standard
+// library, i.e. its first element has no dot (the same rule the go command
+// uses).
+func isStandardPackage(name string) bool {
+	first, _, _ := strings.Cut(name, "/")
+	return !strings.Contains(first, ".")
+}
+
+// TransitiveImports returns the packages the package with the given name
+// (see Package) depends on, directly or through other packages, sorted by
+// name. Dependencies of packages outside the repo (e.g. standard library
+// packages) aren't known, so they don't have any.
+func (r *Repo) TransitiveImports(name string) ([]*Package, error) {
+	pkg, err := r.Package(name)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := map[string]*Package{}
+	queue := []*Package{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, imp := range p.Imports {
+			if _, visited := imports[imp.Package.Name]; visited || imp.Package == pkg {
+				continue
+			}
+			imports[imp.Package.Name] = imp.Package
+			queue = append(queue, imp.Package)
+		}
+	}
+
+	return sortedPackages(imports), nil
+}
+
+// DependsOn returns true if the package named from (see Package) depends on
+// the package named to, directly or through other packages.
+func (r *Repo) DependsOn(from, to string) (bool, error) {
+	imports, err := r.TransitiveImports(from)
+	if err != nil {
+		return false, err
+	}
+
+	toPkg, err := r.Package(to)
+	if err != nil {
+		return false, err
+	}
+
+	i := sort.Search(len(imports), func(i int) bool {
+		return imports[i].Name >= toPkg.Name
+	})
+	return i < len(imports) && imports[i] == toPkg, nil
+}
@@ -0,0 +1,80 @@
+package patrol_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+// importKinds returns the imports of pkg as "name kind module@version".
+func importKinds(pkg *patrol.Package) []string {
+	var imports []string
+	for _, imp := range pkg.Imports {
+		s := imp.Package.Name + " " + imp.Kind.String()
+		if imp.Module != "" {
+			s += " " + imp.Module + "@" + imp.Version
+		}
+		imports = append(imports, s)
+	}
+	return imports
+}
+
+func TestImports(t *testing.T) {
+	t.Run("standard and module", func(t *testing.T) {
+		repo, err := patrol.NewRepo("testdata/apisurface/commits/1")
+		require.NoError(t, err)
+
+		pkg, err := repo.Package("./cmd/app")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"fmt standard",
+			"github.com/utilitywarehouse/apisurface/pkg/bar module",
+		}, importKinds(pkg))
+	})
+
+	t.Run("external", func(t *testing.T) {
+		repo, err := patrol.NewRepo("testdata/modules/commits/1")
+		require.NoError(t, err)
+
+		pkg, err := repo.Package(".")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"github.com/sirupsen/logrus external github.com/sirupsen/logrus@v1.8.0",
+		}, importKinds(pkg))
+	})
+
+	t.Run("vendored", func(t *testing.T) {
+		repo, err := patrol.NewRepo("testdata/vendoring/commits/1")
+		require.NoError(t, err)
+
+		pkg, err := repo.Package(".")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"golang.org/x/mod/modfile vendored golang.org/x/mod@v0.5.1",
+		}, importKinds(pkg))
+	})
+
+	t.Run("transitive imports", func(t *testing.T) {
+		repo, err := patrol.NewRepo("testdata/apisurface/commits/1")
+		require.NoError(t, err)
+
+		imports, err := repo.TransitiveImports("./cmd/app")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"fmt",
+			"github.com/utilitywarehouse/apisurface/pkg/bar",
+			"github.com/utilitywarehouse/apisurface/pkg/foo",
+		}, packageNames(imports))
+
+		dependsOn, err := repo.DependsOn("./cmd/app", "./pkg/foo")
+		require.NoError(t, err)
+		assert.True(t, dependsOn)
+
+		dependsOn, err = repo.DependsOn("./pkg/foo", "./cmd/app")
+		require.NoError(t, err)
+		assert.False(t, dependsOn)
+	})
+}
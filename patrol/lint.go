@@ -0,0 +1,248 @@
+package patrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is patrol's configuration file (.patrol.json at the root of the
+// repository).
+type Config struct {
+	// ImportRules are the rules imports between packages need to follow.
+	ImportRules []ImportRule `json:"importRules"`
+}
+
+// ImportRule restricts the imports of (or to) a set of packages. Packages are
+// matched by package patterns, as in PackageFilter, where * also matches a
+// single path element (e.g. ./services/*). Exactly one of Deny,
+// OnlyImportedBy and Independent needs to be set.
+type ImportRule struct {
+	// Name describes the rule in violations, e.g.: "pkg may not import
+	// services".
+	Name string `json:"name"`
+
+	// Packages are the patterns of the packages the rule applies to.
+	Packages []string `json:"packages"`
+
+	// Deny lists the patterns of the packages that the packages may not
+	// import.
+	Deny []string `json:"deny,omitempty"`
+
+	// OnlyImportedBy lists the patterns of the packages that are allowed to
+	// import the packages. The packages can always import each other.
+	OnlyImportedBy []string `json:"onlyImportedBy,omitempty"`
+
+	// Independent forbids packages matching different instances of the
+	// patterns from importing each other, e.g. with ./services/* packages
+	// under services/a may not import packages under services/b (but can
+	// import other packages under services/a).
+	Independent bool `json:"independent,omitempty"`
+}
+
+// ImportViolation is an import breaking an ImportRule.
+type ImportViolation struct {
+	// Rule is the name of the rule the import breaks.
+	Rule string
+
+	// Package is the name of the importing package, Import the name of the
+	// imported one.
+	Package string
+	Import  string
+
+	// Position of the import, with the file name relative to the root of the
+	// repository.
+	Position token.Position
+}
+
+func (v ImportViolation) String() string {
+	return fmt.Sprintf("%s: %s imports %s (%s)", v.Position, v.Package, v.Import, v.Rule)
+}
+
+// ReadConfig reads patrol's configuration file at path.
+func ReadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// compiledRule is an ImportRule with its patterns resolved and compiled.
+type compiledRule struct {
+	name           string
+	packages       []*regexp.Regexp
+	deny           []*regexp.Regexp
+	onlyImportedBy []*regexp.Regexp
+	independent    bool
+}
+
+// CheckImports returns the imports breaking any of the rules, in the
+// packages with the given names (e.g. the result of ChangesFrom), or in every
+// package within the repo if names is nil. Imports of _test.go files are
+// only checked if tests are part of the graph (see TestsInclude).
+func (r *Repo) CheckImports(rules []ImportRule, names []string) ([]ImportViolation, error) {
+	compiled, err := r.compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	if names == nil {
+		for _, pkg := range r.Packages {
+			if pkg.PartOfModule && pkg.Dir != "" {
+				names = append(names, pkg.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var violations []ImportViolation
+	for _, name := range names {
+		pkg, exists := r.Packages[name]
+		if !exists || pkg.Dir == "" {
+			continue
+		}
+
+		imports := r.importPositions(pkg.Dir)
+
+		for _, imp := range imports {
+			if imp.test && r.tests != TestsInclude {
+				// imports only used by tests are checked only if tests are
+				// included in the graph
+				continue
+			}
+			for _, rule := range compiled {
+				if rule.breaks(name, imp.path) {
+					violations = append(violations, ImportViolation{
+						Rule:     rule.name,
+						Package:  name,
+						Import:   imp.path,
+						Position: imp.position,
+					})
+				}
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+// compileRules validates the rules and compiles their patterns.
+func (r *Repo) compileRules(rules []ImportRule) ([]compiledRule, error) {
+	var compiled []compiledRule
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = "import rule #" + strconv.Itoa(i+1)
+		}
+
+		set := 0
+		for _, ok := range []bool{len(rule.Deny) > 0, len(rule.OnlyImportedBy) > 0, rule.Independent} {
+			if ok {
+				set++
+			}
+		}
+		if len(rule.Packages) == 0 || set != 1 {
+			return nil, fmt.Errorf("%s: packages and exactly one of deny, onlyImportedBy "+
+				"and independent need to be set", name)
+		}
+
+		c := compiledRule{
+			name:           name,
+			packages:       r.compilePatterns(rule.Packages),
+			deny:           r.compilePatterns(rule.Deny),
+			onlyImportedBy: r.compilePatterns(rule.OnlyImportedBy),
+			independent:    rule.Independent,
+		}
+		if rule.Independent {
+			// packages belong to the instance of the pattern they're in
+			c.packages = nil
+			for _, p := range rule.Packages {
+				c.packages = append(c.packages, compileInstancePattern(r.resolvePattern(p)))
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// breaks returns true if pkg importing imp breaks the rule.
+func (c compiledRule) breaks(pkg, imp string) bool {
+	switch {
+	case c.independent:
+		from, to := instance(c.packages, pkg), instance(c.packages, imp)
+		return from != "" && to != "" && from != to
+	case len(c.onlyImportedBy) > 0:
+		return anyMatch(c.packages, imp) && !anyMatch(c.packages, pkg) &&
+			!anyMatch(c.onlyImportedBy, pkg)
+	default:
+		return anyMatch(c.packages, pkg) && anyMatch(c.deny, imp)
+	}
+}
+
+// compileInstancePattern returns a regular expression matching the packages
+// within any instance of pattern, capturing the instance: e.g. for
+// example.com/services/* it captures example.com/services/a for
+// example.com/services/a/cmd/a.
+func compileInstancePattern(pattern string) *regexp.Regexp {
+	re := compilePattern(strings.TrimSuffix(pattern, "/...")).String()
+	re = strings.TrimSuffix(strings.TrimPrefix(re, "^"), "$")
+	return regexp.MustCompile(`^(` + re + `)(/.*)?$`)
+}
+
+// instance returns the instance of the patterns name is in, or an empty
+// string if it doesn't match any of them.
+func instance(patterns []*regexp.Regexp, name string) string {
+	for _, p := range patterns {
+		if m := p.FindStringSubmatch(name); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// importPosition is an import found in a .go file.
+type importPosition struct {
+	path     string
+	position token.Position
+
+	// test is true for imports of _test.go files, whether they belong to
+	// the package or to its external test package
+	test bool
+
+	// external is true for imports of external test packages (e.g. package
+	// foo_test), which aren't part of the graph of packages
+	external bool
+}
+
+// importPositions returns the imports of the package in dir (relative to the
+// root of the repo), and of its external test package, as found when the
+// package was read (so only files that are part of the graph are included),
+// sorted by position.
+func (r *Repo) importPositions(dir string) []importPosition {
+	var imports []importPosition
+	for _, src := range r.sources[dir] {
+		imports = append(imports, src.positions...)
+	}
+
+	sort.SliceStable(imports, func(i, j int) bool {
+		a, b := imports[i].position, imports[j].position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+
+	return imports
+}
@@ -0,0 +1,137 @@
+package patrol_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func violationStrings(violations []patrol.ImportViolation) []string {
+	var result []string
+	for _, v := range violations {
+		result = append(result, v.String())
+	}
+	return result
+}
+
+func TestCheckImports(t *testing.T) {
+	tmp, commits := newTestRepo(t,
+		"testdata/layering/commits/1",
+		"testdata/layering/commits/2",
+	)
+
+	config, err := patrol.ReadConfig(filepath.Join(tmp, ".patrol.json"))
+	require.NoError(t, err)
+
+	repo, err := patrol.NewRepo(tmp)
+	require.NoError(t, err)
+
+	expected := []string{
+		"pkg/util/util.go:6:2: github.com/utilitywarehouse/layering/pkg/util imports " +
+			"github.com/utilitywarehouse/layering/services/a/internal/handler (pkg may not import services)",
+		"services/b/cmd/b/main.go:4:2: github.com/utilitywarehouse/layering/services/b/cmd/b imports " +
+			"github.com/utilitywarehouse/layering/internal/legacy (legacy is only for service a)",
+		"services/b/cmd/b/main.go:6:2: github.com/utilitywarehouse/layering/services/b/cmd/b imports " +
+			"github.com/utilitywarehouse/layering/services/a/internal/handler (services are independent)",
+	}
+
+	t.Run("all packages", func(t *testing.T) {
+		violations, err := repo.CheckImports(config.ImportRules, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, violationStrings(violations))
+	})
+
+	t.Run("changed packages", func(t *testing.T) {
+		changes, err := repo.ChangesFrom(commits[0], false)
+		require.NoError(t, err)
+
+		violations, err := repo.CheckImports(config.ImportRules, changes)
+		require.NoError(t, err)
+		assert.Equal(t, expected, violationStrings(violations))
+	})
+
+	t.Run("some packages", func(t *testing.T) {
+		violations, err := repo.CheckImports(config.ImportRules, []string{
+			"github.com/utilitywarehouse/layering/services/a/cmd/a",
+			"github.com/utilitywarehouse/layering/services/a/internal/handler",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("target revision", func(t *testing.T) {
+		repo, err := patrol.NewRepo(tmp, patrol.Target(commits[0]))
+		require.NoError(t, err)
+
+		// the working tree has violations, the target doesn't
+		violations, err := repo.CheckImports(config.ImportRules, nil)
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("ignored files", func(t *testing.T) {
+		tmp, _ := newTestRepo(t,
+			"testdata/layering/commits/1",
+			"testdata/layering/commits/2",
+		)
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "pkg/util/doc.go"), []byte("package util\n"), 0600))
+
+		repo, err := patrol.NewRepo(tmp, patrol.Ignore("pkg/util/util.go"))
+		require.NoError(t, err)
+
+		violations, err := repo.CheckImports(config.ImportRules, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected[1:], violationStrings(violations))
+	})
+
+	t.Run("test files", func(t *testing.T) {
+		tmp, _ := newTestRepo(t, "testdata/layering/commits/1")
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "pkg/util/util_test.go"), []byte("package util\n\n"+
+			"import _ \"github.com/utilitywarehouse/layering/services/a/internal/handler\"\n"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "pkg/util/export_test.go"), []byte("package util_test\n\n"+
+			"import _ \"github.com/utilitywarehouse/layering/services/b/cmd/b\"\n"), 0600))
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		violations, err := repo.CheckImports(config.ImportRules, nil)
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+
+		repo, err = patrol.NewRepo(tmp, patrol.Tests(patrol.TestsInclude))
+		require.NoError(t, err)
+
+		violations, err = repo.CheckImports(config.ImportRules, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"pkg/util/export_test.go:3:8: github.com/utilitywarehouse/layering/pkg/util imports " +
+				"github.com/utilitywarehouse/layering/services/b/cmd/b (pkg may not import services)",
+			"pkg/util/util_test.go:3:8: github.com/utilitywarehouse/layering/pkg/util imports " +
+				"github.com/utilitywarehouse/layering/services/a/internal/handler (pkg may not import services)",
+		}, violationStrings(violations))
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		_, err := repo.CheckImports([]patrol.ImportRule{
+			{Packages: []string{"./pkg/..."}, Deny: []string{"./services/..."}, Independent: true},
+		}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckImportsNoViolations(t *testing.T) {
+	config, err := patrol.ReadConfig("testdata/layering/commits/1/.patrol.json")
+	require.NoError(t, err)
+
+	repo, err := patrol.NewRepo("testdata/layering/commits/1")
+	require.NoError(t, err)
+
+	violations, err := repo.CheckImports(config.ImportRules, nil)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+}
@@ -0,0 +1,183 @@
+package patrol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitChanges lists the packages affected by a single commit.
+type CommitChanges struct {
+	// Hash of the commit.
+	Hash string
+
+	// Subject is the first line of the commit message.
+	Subject string
+
+	// Changes lists (sorted) the packages within the repository that changed
+	// in the commit, compared to its first parent. Every package is listed
+	// for commits without parents.
+	Changes []string
+}
+
+// Log returns the packages affected by each commit reachable from to but not
+// from from (like git log from..to), newest first. Each commit is compared to
+// its first parent, so merge commits list everything they brought in. If
+// firstParent is set, only the first parent of merge commits is followed
+// (from then needs to be reached that way).
+//
+// allChanges is the same as in ChangesFrom, and the options r was created
+// with (e.g. SemanticDiff) apply, but r's packages aren't modified: the packages of
+// each commit are read from git, and only parsed again where they changed.
+func (r *Repo) Log(from, to string, firstParent, allChanges bool) ([]CommitChanges, error) {
+	g, err := r.openGoGit()
+	if err != nil {
+		return nil, err
+	}
+
+	fromCommit, err := g.resolveCommit(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toCommit, err := g.resolveCommit(to)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := commitRange(g.repo, fromCommit.Hash, toCommit.Hash, firstParent)
+	if err != nil {
+		return nil, err
+	}
+
+	log := make([]CommitChanges, len(commits))
+	err = r.walkCommits(commits, allChanges, func(i int, commit *object.Commit, walker *Repo, changes []string) error {
+		// commits are walked oldest first, but listed newest first
+		log[len(commits)-1-i] = CommitChanges{
+			Hash:    commit.Hash.String(),
+			Subject: strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0],
+			Changes: changes,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// walkCommits detects the changes of each of the given commits (compared to
+// their first parent), oldest first, and calls fn with the packages within
+// the repository that changed (sorted). walker holds the packages at the
+// commit, with the changes flagged. It's only valid until fn returns.
+func (r *Repo) walkCommits(commits []*object.Commit, allChanges bool, fn func(i int, commit *object.Commit, walker *Repo, changes []string) error) error {
+	// the configuration is shared, the packages are read from each commit
+	walker := *r
+	walker.tree = nil
+	walker.commit = ""
+	walker.sources = nil
+
+	// each commit is compared to its parent, rather than to the working tree
+	// or the target revision
+	walker.worktree = false
+	walker.mergeBase = false
+	walker.target = ""
+
+	for i, commit := range commits {
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+
+		walker.commit = commit.Hash.String()
+		if err := walker.loadTree(tree); err != nil {
+			return fmt.Errorf("%s: %w", commit.Hash, err)
+		}
+
+		var changes []string
+		if commit.NumParents() == 0 {
+			// everything was added
+			for _, pkg := range walker.Packages {
+				if pkg.PartOfModule {
+					walker.flagPackageAsChanged(pkg.Name, ChangedAPI)
+					changes = append(changes, pkg.Name)
+				}
+			}
+		} else {
+			changes, err = walker.ChangesFrom(commit.ParentHashes[0].String(), allChanges)
+			if err != nil {
+				return fmt.Errorf("%s: %w", commit.Hash, err)
+			}
+		}
+		sort.Strings(changes)
+
+		if err := fn(i, commit, &walker, changes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitRange returns the commits reachable from to but not from from,
+// oldest first. If firstParent is set only the first parent of merge commits
+// is followed, and from needs to be reached that way.
+func commitRange(repo *git.Repository, from, to plumbing.Hash, firstParent bool) ([]*object.Commit, error) {
+	commit, err := repo.CommitObject(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	if firstParent {
+		for commit.Hash != from {
+			if commit.NumParents() == 0 {
+				return nil, fmt.Errorf("%s is not a first parent ancestor of %s", from, to)
+			}
+			commits = append(commits, commit)
+
+			commit, err = commit.Parent(0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		fromCommit, err := repo.CommitObject(from)
+		if err != nil {
+			return nil, err
+		}
+
+		excluded := map[plumbing.Hash]bool{}
+		err = object.NewCommitPreorderIter(fromCommit, nil, nil).ForEach(func(c *object.Commit) error {
+			excluded[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = object.NewCommitIterCTime(commit, excluded, nil).ForEach(func(c *object.Commit) error {
+			commits = append(commits, c)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// commits were found newest first
+	reverseCommits(commits)
+	return commits, nil
+}
+
+// reverseCommits reverses the order of commits in place.
+func reverseCommits(commits []*object.Commit) {
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+}
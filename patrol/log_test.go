@@ -0,0 +1,84 @@
+package patrol_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestLog(t *testing.T) {
+	tmp, commits := newTestRepo(t,
+		"testdata/multimodule/commits/1",
+		"testdata/multimodule/commits/2",
+		"testdata/multimodule/commits/3",
+		"testdata/multimodule/commits/4",
+	)
+
+	repo, err := patrol.NewRepo(tmp)
+	require.NoError(t, err)
+
+	expected := []patrol.CommitChanges{
+		{
+			Hash:    commits[3],
+			Subject: "commit #4",
+			Changes: []string{"github.com/utilitywarehouse/multimodule"},
+		},
+		{
+			Hash:    commits[2],
+			Subject: "commit #3",
+			Changes: []string{"example.com/tools/cmd/gen"},
+		},
+		{
+			Hash:    commits[1],
+			Subject: "commit #2",
+			Changes: []string{
+				"example.com/tools/cmd/gen",
+				"github.com/utilitywarehouse/multimodule",
+				"github.com/utilitywarehouse/multimodule/pkg/foo",
+			},
+		},
+	}
+
+	t.Run("first parent", func(t *testing.T) {
+		log, err := repo.Log(commits[0], commits[3], true, false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, log)
+	})
+
+	t.Run("all commits", func(t *testing.T) {
+		log, err := repo.Log(commits[0], commits[3], false, false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, log)
+	})
+
+	t.Run("matches ChangesFrom", func(t *testing.T) {
+		log, err := repo.Log(commits[0], commits[3], true, false)
+		require.NoError(t, err)
+
+		// HEAD is the last commit, so its changes are the same
+		changes, err := repo.ChangesFrom(commits[2], false)
+		require.NoError(t, err)
+		sort.Strings(changes)
+		assert.Equal(t, changes, log[0].Changes)
+	})
+
+	t.Run("repo is not modified", func(t *testing.T) {
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		_, err = repo.Log(commits[0], commits[3], true, false)
+		require.NoError(t, err)
+		for _, pkg := range repo.Packages {
+			assert.False(t, pkg.Changed, pkg.Name)
+		}
+	})
+
+	t.Run("from is not an ancestor", func(t *testing.T) {
+		_, err := repo.Log(commits[3], commits[0], true, false)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,126 @@
+package patrol
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PackageFilter selects packages using go command package patterns, e.g.:
+// ./services/... or github.com/org/repo/pkg/... (see go help packages).
+// Relative patterns are resolved from the root of the repository, and * can
+// be used to match a single path element (e.g. ./services/*/cmd/...).
+type PackageFilter struct {
+	// Match lists the patterns packages need to match (any of them) to be
+	// selected. If empty, all packages are selected.
+	Match []string
+
+	// Exclude lists the patterns of packages that shouldn't be selected, even
+	// if they match any of the Match patterns.
+	Exclude []string
+}
+
+// FilterPackages returns the packages in names (e.g. the result of
+// ChangesFrom) selected by filter, preserving their order.
+func (r *Repo) FilterPackages(names []string, filter PackageFilter) []string {
+	match := r.compilePatterns(filter.Match)
+	exclude := r.compilePatterns(filter.Exclude)
+
+	var result []string
+	for _, name := range names {
+		if len(match) > 0 && !anyMatch(match, name) {
+			continue
+		}
+		if anyMatch(exclude, name) {
+			continue
+		}
+		result = append(result, name)
+	}
+
+	return result
+}
+
+// compilePatterns turns package patterns into regular expressions matching
+// package names.
+func (r *Repo) compilePatterns(patterns []string) []*regexp.Regexp {
+	var result []*regexp.Regexp
+	for _, pattern := range patterns {
+		if re, ok := r.compileVendorPattern(pattern); ok {
+			result = append(result, re)
+			continue
+		}
+		result = append(result, compilePattern(r.resolvePattern(pattern)))
+	}
+	return result
+}
+
+// compileVendorPattern handles the relative patterns for the vendor directory
+// itself, ./vendor and ./vendor/..., which can't be turned into import paths:
+// vendored packages are named after their own import path, with nothing in
+// common. The regular expression matches the packages found in the vendor
+// directory (or in any of its subdirectories), by name. Vendored packages
+// are never part of the changes, so these patterns only select anything
+// among imports (see ImportRule) or the packages of the graph.
+func (r *Repo) compileVendorPattern(pattern string) (*regexp.Regexp, bool) {
+	if !strings.HasPrefix(pattern, "./") {
+		return nil, false
+	}
+
+	var inVendor func(dir string) bool
+	switch path.Clean(pattern) {
+	case "vendor":
+		inVendor = func(dir string) bool { return dir == "vendor" }
+	case "vendor/...":
+		inVendor = func(dir string) bool { return strings.HasPrefix(dir, "vendor/") }
+	default:
+		return nil, false
+	}
+
+	var names []string
+	for _, pkg := range sortedPackages(r.Packages) {
+		if inVendor(pkg.Dir) {
+			names = append(names, regexp.QuoteMeta(pkg.Name))
+		}
+	}
+	if len(names) == 0 {
+		// matches nothing
+		return regexp.MustCompile(`^[^\s\S]$`), true
+	}
+	return regexp.MustCompile(`^(?:` + strings.Join(names, "|") + `)$`), true
+}
+
+// resolvePattern turns relative patterns (starting with ./ or ../) into
+// patterns of import paths within the module (or the nested module they
+// point into).
+func (r *Repo) resolvePattern(pattern string) string {
+	if pattern != "." && pattern != ".." &&
+		!strings.HasPrefix(pattern, "./") && !strings.HasPrefix(pattern, "../") {
+		return pattern
+	}
+
+	return r.packageName(path.Clean(pattern))
+}
+
+// compilePattern returns a regular expression matching the same packages as
+// pattern, the same way the go command does: ... matches any string, and a
+// trailing /... also matches the package it's appended to (x/... matches x).
+// Unlike the go command, * matches any string within a path element.
+func compilePattern(pattern string) *regexp.Regexp {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	re = strings.ReplaceAll(re, `\*`, `[^/]*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	return regexp.MustCompile(`^` + re + `$`)
+}
+
+// anyMatch returns true if name matches any of the given patterns.
+func anyMatch(patterns []*regexp.Regexp, name string) bool {
+	for _, p := range patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
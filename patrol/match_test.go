@@ -0,0 +1,163 @@
+package patrol_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestFilterPackages(t *testing.T) {
+	r, err := patrol.NewRepo("testdata/internalchange/commits/1")
+	require.NoError(t, err)
+
+	const (
+		bar = "github.com/utilitywarehouse/internalchange/internal/bar"
+		cat = "github.com/utilitywarehouse/internalchange/pkg/cat"
+		foo = "github.com/utilitywarehouse/internalchange/pkg/foo"
+	)
+	changes := []string{bar, cat, foo}
+
+	tests := []struct {
+		name     string
+		filter   patrol.PackageFilter
+		expected []string
+	}{
+		{
+			name:     "no patterns",
+			filter:   patrol.PackageFilter{},
+			expected: []string{bar, cat, foo},
+		},
+		{
+			name:     "relative pattern",
+			filter:   patrol.PackageFilter{Match: []string{"./pkg/..."}},
+			expected: []string{cat, foo},
+		},
+		{
+			name:     "all packages in module",
+			filter:   patrol.PackageFilter{Match: []string{"./..."}},
+			expected: []string{bar, cat, foo},
+		},
+		{
+			name:     "import path pattern",
+			filter:   patrol.PackageFilter{Match: []string{"github.com/utilitywarehouse/internalchange/internal/..."}},
+			expected: []string{bar},
+		},
+		{
+			name:     "trailing /... matches the package itself",
+			filter:   patrol.PackageFilter{Match: []string{"./pkg/foo/..."}},
+			expected: []string{foo},
+		},
+		{
+			name:     "wildcard within an element",
+			filter:   patrol.PackageFilter{Match: []string{"./pkg/c..."}},
+			expected: []string{cat},
+		},
+		{
+			name:     "exact package",
+			filter:   patrol.PackageFilter{Match: []string{"./pkg/foo", "./internal/bar"}},
+			expected: []string{bar, foo},
+		},
+		{
+			name:     "exclude",
+			filter:   patrol.PackageFilter{Match: []string{"./..."}, Exclude: []string{"./pkg/cat"}},
+			expected: []string{bar, foo},
+		},
+		{
+			name:     "exclude only",
+			filter:   patrol.PackageFilter{Exclude: []string{"./internal/..."}},
+			expected: []string{cat, foo},
+		},
+		{
+			name:   "no match",
+			filter: patrol.PackageFilter{Match: []string{"./services/..."}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, r.FilterPackages(changes, test.filter))
+		})
+	}
+}
+
+func TestFilterVendoredPackages(t *testing.T) {
+	r, err := patrol.NewRepo("testdata/vendoring/commits/1")
+	require.NoError(t, err)
+
+	const (
+		root    = "github.com/utilitywarehouse/vendoring"
+		modfile = "golang.org/x/mod/modfile"
+		semver  = "golang.org/x/mod/semver"
+		xerrors = "golang.org/x/xerrors"
+	)
+	changes := []string{root, modfile, semver, xerrors}
+
+	tests := []struct {
+		name     string
+		filter   patrol.PackageFilter
+		expected []string
+	}{
+		{
+			name:     "match vendor/...",
+			filter:   patrol.PackageFilter{Match: []string{"./vendor/..."}},
+			expected: []string{modfile, semver, xerrors},
+		},
+		{
+			name:     "exclude vendor/...",
+			filter:   patrol.PackageFilter{Exclude: []string{"./vendor/..."}},
+			expected: []string{root},
+		},
+		{
+			name:   "match vendor",
+			filter: patrol.PackageFilter{Match: []string{"./vendor"}},
+		},
+		{
+			name:     "exclude vendor",
+			filter:   patrol.PackageFilter{Exclude: []string{"./vendor"}},
+			expected: []string{root, modfile, semver, xerrors},
+		},
+		{
+			name:     "vendored package",
+			filter:   patrol.PackageFilter{Match: []string{"./vendor/golang.org/x/mod/..."}},
+			expected: []string{modfile, semver},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, r.FilterPackages(changes, test.filter))
+		})
+	}
+}
+
+func TestVendorPatternsWhereTheyMatter(t *testing.T) {
+	tmp, commits := newTestRepo(t,
+		"testdata/vendoring/commits/1",
+		"testdata/vendoring/commits/2",
+	)
+
+	r, err := patrol.NewRepo(tmp)
+	require.NoError(t, err)
+
+	t.Run("changes", func(t *testing.T) {
+		// vendored packages that changed flag their importers, but are never
+		// reported themselves
+		changes, err := r.ChangesFrom(commits[0], false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com/utilitywarehouse/vendoring"}, changes)
+		assert.Empty(t, r.FilterPackages(changes, patrol.PackageFilter{Match: []string{"./vendor/..."}}))
+	})
+
+	t.Run("import rules", func(t *testing.T) {
+		violations, err := r.CheckImports([]patrol.ImportRule{
+			{Name: "no vendored packages", Packages: []string{"./..."}, Deny: []string{"./vendor/..."}},
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"main.go:3:8: github.com/utilitywarehouse/vendoring imports golang.org/x/mod/modfile (no vendored packages)",
+		}, violationStrings(violations))
+	})
+}
@@ -0,0 +1,240 @@
+package patrol
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"errors"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// moduleTree is a version of a module as found in the module cache.
+type moduleTree struct {
+	path string
+
+	// hash of each file in the module, with the path relative to the module
+	// root as key
+	files map[string][sha256.Size]byte
+
+	// imports of each package in the module, with the package directory
+	// (relative to the module root) as key
+	imports map[string][]string
+}
+
+// changedModulePackages returns the import path of the packages in module
+// that changed between the two versions, including the ones importing
+// changed packages within the same module. It returns false if any of the
+// versions can't be found in the module cache.
+func changedModulePackages(modCache, modulePath, oldVersion, newVersion string) ([]string, bool, error) {
+	if oldVersion == "" || newVersion == "" {
+		// the module was either added or removed
+		return nil, false, nil
+	}
+
+	oldTree, err := readModuleTree(modCache, modulePath, oldVersion)
+	if err != nil || oldTree == nil {
+		return nil, false, err
+	}
+
+	newTree, err := readModuleTree(modCache, modulePath, newVersion)
+	if err != nil || newTree == nil {
+		return nil, false, err
+	}
+
+	changedDirs := map[string]bool{}
+	for name, hash := range newTree.files {
+		if oldHash, exists := oldTree.files[name]; !exists || oldHash != hash {
+			if dir, ok := newTree.packageDirForFile(name, oldTree); ok {
+				changedDirs[dir] = true
+			}
+		}
+	}
+	for name := range oldTree.files {
+		if _, exists := newTree.files[name]; !exists {
+			if dir, ok := newTree.packageDirForFile(name, oldTree); ok {
+				changedDirs[dir] = true
+			}
+		}
+	}
+
+	// packages importing changed packages within the same module changed as
+	// well
+	dependants := map[string][]string{}
+	for dir, imports := range newTree.imports {
+		for _, imp := range imports {
+			dependants[imp] = append(dependants[imp], newTree.importPath(dir))
+		}
+	}
+
+	changed := map[string]bool{}
+	var queue []string
+	for dir := range changedDirs {
+		queue = append(queue, newTree.importPath(dir))
+	}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if changed[pkg] {
+			continue
+		}
+		changed[pkg] = true
+		queue = append(queue, dependants[pkg]...)
+	}
+
+	var result []string
+	for pkg := range changed {
+		result = append(result, pkg)
+	}
+
+	return result, true, nil
+}
+
+// importPath returns the import path of the package in dir.
+func (t *moduleTree) importPath(dir string) string {
+	if dir == "." {
+		return t.path
+	}
+	return t.path + "/" + dir
+}
+
+// packageDirForFile returns the directory of the package the given file
+// belongs to in either version of the module. Files that can't affect
+// importers of the module, such as tests or files outside of any package,
+// are ignored.
+func (t *moduleTree) packageDirForFile(name string, other *moduleTree) (string, bool) {
+	if strings.HasSuffix(name, "_test.go") || strings.Contains("/"+name, "/testdata/") ||
+		name == "go.mod" || name == "go.sum" {
+		// tests can't affect importers, and changes to the requirements of
+		// the module show up in our go.mod as well
+		return "", false
+	}
+
+	dir := path.Dir(name)
+	if strings.HasSuffix(name, ".go") {
+		return dir, true
+	}
+
+	// other files might be embedded by the closest package
+	for {
+		if _, ok := t.imports[dir]; ok {
+			return dir, true
+		}
+		if _, ok := other.imports[dir]; ok {
+			return dir, true
+		}
+		if dir == "." {
+			return "", false
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// readModuleTree reads the given version of a module from the module cache,
+// either from the extracted directory or from the downloaded zip file. It
+// returns nil if the module can't be found.
+func readModuleTree(modCache, modulePath, version string) (*moduleTree, error) {
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &moduleTree{
+		path:    modulePath,
+		files:   map[string][sha256.Size]byte{},
+		imports: map[string][]string{},
+	}
+
+	dir := filepath.Join(modCache, filepath.FromSlash(escapedPath)+"@"+escapedVersion)
+	if _, err := os.Stat(dir); err == nil {
+		err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			tree.add(filepath.ToSlash(rel), b)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return tree, nil
+	}
+
+	zipPath := filepath.Join(modCache, "cache", "download", filepath.FromSlash(escapedPath), "@v", escapedVersion+".zip")
+	z, err := zip.OpenReader(zipPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close() // nolint
+
+	prefix := modulePath + "@" + version + "/"
+	for _, f := range z.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(r)
+		r.Close() // nolint
+		if err != nil {
+			return nil, err
+		}
+		tree.add(strings.TrimPrefix(f.Name, prefix), b)
+	}
+
+	return tree, nil
+}
+
+// add adds the file with the given name and contents to the module tree.
+func (t *moduleTree) add(name string, contents []byte) {
+	t.files[name] = sha256.Sum256(contents)
+
+	if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+		return
+	}
+
+	dir := path.Dir(name)
+	if _, exists := t.imports[dir]; !exists {
+		t.imports[dir] = nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), name, contents, parser.ImportsOnly)
+	if err != nil {
+		// the file will still be compared, its imports are only used to find
+		// packages depending on it
+		return
+	}
+
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err == nil && (p == t.path || strings.HasPrefix(p, t.path+"/")) {
+			t.imports[dir] = append(t.imports[dir], p)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package patrol
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModule = "example.com/Mod"
+
+// testModuleFiles are the files of testModule at version v1.0.0.
+var testModuleFiles = map[string]string{
+	"go.mod":                          "module example.com/Mod\n",
+	"mod.go":                          "package mod\n\nimport _ \"example.com/Mod/internal/util\"\n",
+	"mod_test.go":                     "package mod\n",
+	"api/api.go":                      "package api\n\nimport \"example.com/Mod\"\n\nvar _ = mod.X\n",
+	"internal/util/u.go":              "package util\n\nimport \"strings\"\n\nvar _ = strings.ToUpper\n",
+	"internal/util/static/index.html": "<html></html>\n",
+	"internal/util/testdata/in.txt":   "in\n",
+	"other/other.go":                  "package other\n",
+	"README.md":                       "# mod\n",
+}
+
+// writeExtractedModule writes files as the given version of testModule,
+// extracted in the module cache.
+func writeExtractedModule(t *testing.T, modCache, version string, files map[string]string) {
+	t.Helper()
+
+	// upper case letters are escaped in the module cache
+	dir := filepath.Join(modCache, "example.com", "!mod@"+version)
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0o644))
+	}
+}
+
+// writeZippedModule writes files as the given version of testModule, only
+// downloaded to the module cache.
+func writeZippedModule(t *testing.T, modCache, version string, files map[string]string) {
+	t.Helper()
+
+	dir := filepath.Join(modCache, "cache", "download", "example.com", "!mod", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+
+	f, err := os.Create(filepath.Join(dir, version+".zip"))
+	require.NoError(t, err)
+	defer f.Close() // nolint
+
+	z := zip.NewWriter(f)
+	for name, contents := range files {
+		// files in module zips are prefixed by the unescaped path
+		w, err := z.Create(testModule + "@" + version + "/" + name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, z.Close())
+}
+
+// withFiles returns a copy of testModuleFiles with the given changes, files
+// with empty contents are removed.
+func withFiles(changes map[string]string) map[string]string {
+	files := map[string]string{}
+	for name, contents := range testModuleFiles {
+		files[name] = contents
+	}
+	for name, contents := range changes {
+		if contents == "" {
+			delete(files, name)
+			continue
+		}
+		files[name] = contents
+	}
+	return files
+}
+
+func TestReadModuleTree(t *testing.T) {
+	modCache := t.TempDir()
+	writeExtractedModule(t, modCache, "v1.0.0", testModuleFiles)
+	writeZippedModule(t, modCache, "v1.0.0", testModuleFiles)
+	writeZippedModule(t, modCache, "v1.1.0", testModuleFiles)
+
+	extracted, err := readModuleTree(modCache, testModule, "v1.0.0")
+	require.NoError(t, err)
+	require.NotNil(t, extracted)
+
+	assert.Equal(t, testModule, extracted.path)
+	assert.Len(t, extracted.files, len(testModuleFiles))
+	assert.Equal(t, map[string][]string{
+		".":             {"example.com/Mod/internal/util"},
+		"api":           {"example.com/Mod"},
+		"internal/util": nil,
+		"other":         nil,
+	}, extracted.imports)
+
+	zipped, err := readModuleTree(modCache, testModule, "v1.1.0")
+	require.NoError(t, err)
+	require.NotNil(t, zipped)
+
+	assert.Equal(t, extracted.files, zipped.files)
+	assert.Equal(t, extracted.imports, zipped.imports)
+
+	missing, err := readModuleTree(modCache, testModule, "v2.0.0")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestChangedModulePackages(t *testing.T) {
+	const (
+		root  = "example.com/Mod"
+		api   = "example.com/Mod/api"
+		util  = "example.com/Mod/internal/util"
+		other = "example.com/Mod/other"
+	)
+
+	tests := []struct {
+		name     string
+		changes  map[string]string
+		expected []string
+	}{
+		{
+			name: "unchanged",
+		},
+		{
+			name:     "leaf package",
+			changes:  map[string]string{"other/other.go": "package other\n\nvar X int\n"},
+			expected: []string{other},
+		},
+		{
+			name:     "imported package",
+			changes:  map[string]string{"internal/util/u.go": "package util\n"},
+			expected: []string{root, api, util},
+		},
+		{
+			name:     "added file",
+			changes:  map[string]string{"api/new.go": "package api\n"},
+			expected: []string{api},
+		},
+		{
+			name:     "removed file",
+			changes:  map[string]string{"other/other.go": ""},
+			expected: []string{other},
+		},
+		{
+			name:     "embedded file",
+			changes:  map[string]string{"internal/util/static/index.html": "<html>changed</html>\n"},
+			expected: []string{root, api, util},
+		},
+		{
+			name: "tests, testdata and requirements",
+			changes: map[string]string{
+				"mod_test.go":                   "package mod\n\nfunc TestX() {}\n",
+				"internal/util/testdata/in.txt": "changed\n",
+				"go.mod":                        "module example.com/Mod\n\ngo 1.22\n",
+			},
+		},
+		{
+			name:    "files outside of packages",
+			changes: map[string]string{"README.md": "# changed\n"},
+			// the root directory is a package
+			expected: []string{root, api},
+		},
+	}
+
+	layouts := []struct {
+		name     string
+		old, new func(t *testing.T, modCache, version string, files map[string]string)
+	}{
+		{name: "extracted", old: writeExtractedModule, new: writeExtractedModule},
+		{name: "zipped", old: writeZippedModule, new: writeZippedModule},
+		{name: "extracted and zipped", old: writeExtractedModule, new: writeZippedModule},
+	}
+
+	for _, layout := range layouts {
+		t.Run(layout.name, func(t *testing.T) {
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					modCache := t.TempDir()
+					layout.old(t, modCache, "v1.0.0", testModuleFiles)
+					layout.new(t, modCache, "v1.1.0", withFiles(test.changes))
+
+					changed, found, err := changedModulePackages(modCache, testModule, "v1.0.0", "v1.1.0")
+					require.NoError(t, err)
+					assert.True(t, found)
+
+					slices.Sort(changed)
+					assert.Equal(t, test.expected, changed)
+				})
+			}
+		})
+	}
+}
+
+func TestChangedModulePackagesNotFound(t *testing.T) {
+	modCache := t.TempDir()
+	writeZippedModule(t, modCache, "v1.0.0", testModuleFiles)
+
+	tests := []struct {
+		name     string
+		old, new string
+	}{
+		{name: "added module", new: "v1.0.0"},
+		{name: "removed module", old: "v1.0.0"},
+		{name: "old version missing", old: "v0.9.0", new: "v1.0.0"},
+		{name: "new version missing", old: "v1.0.0", new: "v1.1.0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changed, found, err := changedModulePackages(modCache, testModule, test.old, test.new)
+			require.NoError(t, err)
+			assert.False(t, found)
+			assert.Nil(t, changed)
+		})
+	}
+}
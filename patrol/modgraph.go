@@ -0,0 +1,158 @@
+package patrol
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// moduleGraph maps each module path to the paths of the modules requiring
+// it. Versions are ignored, a module requiring any version of another one is
+// considered to depend on it.
+type moduleGraph map[string][]string
+
+// readModuleGraph parses the output of go mod graph stored in the file at
+// path.
+func readModuleGraph(path string) (moduleGraph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint
+
+	graph := moduleGraph{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		requirer, _, _ := strings.Cut(fields[0], "@")
+		required, _, _ := strings.Cut(fields[1], "@")
+		graph.add(requirer, required)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+// moduleGraphFromCache builds the module graph starting from the
+// requirements in mod, reading the go.mod file of each required module from
+// the module cache. Modules whose go.mod file isn't in the cache are assumed
+// to have no requirements.
+func moduleGraphFromCache(modCache string, mod *modfile.File) (moduleGraph, error) {
+	// versions selected by our go.mod take precedence over the ones required
+	// by dependencies
+	selected := map[string]string{}
+	for _, req := range mod.Require {
+		selected[req.Mod.Path] = req.Mod.Version
+	}
+
+	graph := moduleGraph{}
+	visited := map[string]bool{}
+	var queue []module.Version
+	for _, req := range mod.Require {
+		graph.add(mod.Module.Mod.Path, req.Mod.Path)
+		queue = append(queue, req.Mod)
+	}
+
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		if visited[m.Path] {
+			continue
+		}
+		visited[m.Path] = true
+
+		if v, ok := selected[m.Path]; ok {
+			m.Version = v
+		}
+
+		depMod, err := readCachedGoMod(modCache, m)
+		if err != nil {
+			return nil, err
+		}
+		if depMod == nil {
+			continue
+		}
+
+		for _, req := range depMod.Require {
+			graph.add(m.Path, req.Mod.Path)
+			queue = append(queue, req.Mod)
+		}
+	}
+
+	return graph, nil
+}
+
+// readCachedGoMod returns the go.mod file of the given module version from
+// the module cache, or nil if it can't be found.
+func readCachedGoMod(modCache string, m module.Version) (*modfile.File, error) {
+	escapedPath, err := module.EscapePath(m.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	escapedVersion, err := module.EscapeVersion(m.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{
+		filepath.Join(modCache, "cache", "download", filepath.FromSlash(escapedPath), "@v", escapedVersion+".mod"),
+		filepath.Join(modCache, filepath.FromSlash(escapedPath)+"@"+escapedVersion, "go.mod"),
+	}
+
+	for _, candidate := range candidates {
+		b, err := os.ReadFile(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return modfile.ParseLax(candidate, b, nil)
+	}
+
+	return nil, nil
+}
+
+// add records that requirer requires required.
+func (g moduleGraph) add(requirer, required string) {
+	for _, r := range g[required] {
+		if r == requirer {
+			return
+		}
+	}
+	g[required] = append(g[required], requirer)
+}
+
+// requirers returns all the modules requiring the given one, directly or
+// transitively.
+func (g moduleGraph) requirers(path string) []string {
+	visited := map[string]bool{path: true}
+	queue := []string{path}
+	var result []string
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, r := range g[current] {
+			if visited[r] {
+				continue
+			}
+			visited[r] = true
+			result = append(result, r)
+			queue = append(queue, r)
+		}
+	}
+	return result
+}
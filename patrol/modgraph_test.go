@@ -0,0 +1,110 @@
+package patrol
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+)
+
+func TestModuleGraphRequirers(t *testing.T) {
+	graph := moduleGraph{}
+	graph.add("example.com/main", "example.com/a")
+	graph.add("example.com/main", "example.com/b")
+	graph.add("example.com/a", "example.com/c")
+	graph.add("example.com/b", "example.com/c")
+	graph.add("example.com/c", "example.com/d")
+	// cycles are allowed between modules
+	graph.add("example.com/d", "example.com/c")
+	graph.add("example.com/a", "example.com/c")
+
+	tests := []struct {
+		module   string
+		expected []string
+	}{
+		{module: "example.com/main"},
+		{module: "example.com/unknown"},
+		{module: "example.com/a", expected: []string{"example.com/main"}},
+		{module: "example.com/c", expected: []string{"example.com/a", "example.com/b", "example.com/d", "example.com/main"}},
+		{module: "example.com/d", expected: []string{"example.com/a", "example.com/b", "example.com/c", "example.com/main"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.module, func(t *testing.T) {
+			requirers := graph.requirers(test.module)
+			slices.Sort(requirers)
+			assert.Equal(t, test.expected, requirers)
+		})
+	}
+
+	// requirements are only recorded once
+	assert.Equal(t, []string{"example.com/a", "example.com/b"}, graph["example.com/c"][:2])
+	assert.Len(t, graph["example.com/c"], 3)
+}
+
+func TestReadModuleGraph(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`example.com/main example.com/a@v1.0.0
+example.com/main example.com/b@v1.2.0
+example.com/a@v1.0.0 example.com/c@v0.1.0
+example.com/b@v1.2.0 example.com/c@v0.2.0
+example.com/main go@1.22
+
+`), 0o644))
+
+	graph, err := readModuleGraph(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, moduleGraph{
+		"example.com/a": {"example.com/main"},
+		"example.com/b": {"example.com/main"},
+		"example.com/c": {"example.com/a", "example.com/b"},
+		"go":            {"example.com/main"},
+	}, graph)
+
+	_, err = readModuleGraph(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestModuleGraphFromCache(t *testing.T) {
+	modCache := t.TempDir()
+	write := func(name, contents string) {
+		p := filepath.Join(modCache, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0o644))
+	}
+
+	// downloaded go.mod files
+	write("cache/download/example.com/a/@v/v1.0.0.mod", "module example.com/a\n\nrequire example.com/c v0.1.0\n")
+	// extracted module (with an escaped path)
+	write("example.com/!b@v1.2.0/go.mod", "module example.com/B\n\nrequire example.com/d v1.0.0\n")
+	// only the version selected by the main module is read
+	write("cache/download/example.com/c/@v/v0.1.0.mod", "module example.com/c\n\nrequire example.com/old v1.0.0\n")
+	write("cache/download/example.com/c/@v/v0.2.0.mod", "module example.com/c\n\nrequire example.com/e v1.0.0\n")
+	// example.com/d and example.com/e aren't in the cache
+
+	mod, err := modfile.Parse("go.mod", []byte(`module example.com/main
+
+require (
+	example.com/a v1.0.0
+	example.com/B v1.2.0
+	example.com/c v0.2.0
+)
+`), nil)
+	require.NoError(t, err)
+
+	graph, err := moduleGraphFromCache(modCache, mod)
+	require.NoError(t, err)
+
+	assert.Equal(t, moduleGraph{
+		"example.com/a": {"example.com/main"},
+		"example.com/B": {"example.com/main"},
+		"example.com/c": {"example.com/main", "example.com/a"},
+		"example.com/d": {"example.com/B"},
+		"example.com/e": {"example.com/c"},
+	}, graph)
+}
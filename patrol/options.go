@@ -0,0 +1,257 @@
+package patrol
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"log"
+	"path"
+	"strings"
+)
+
+// Option configures how NewRepo reads the repo and how Changes detects
+// changes.
+type Option func(*Repo)
+
+// TestMode decides how Changes handles tests.
+type TestMode string
+
+const (
+	// TestsChange flags packages whose _test.go files changed, but packages
+	// only imported by tests aren't dependencies. This is the default mode.
+	TestsChange TestMode = "change"
+	// TestsIgnore ignores changes to _test.go files.
+	TestsIgnore TestMode = "ignore"
+	// TestsInclude also makes the packages imported by tests (including
+	// external test packages) dependencies of the package they test, so
+	// their changes flag it.
+	TestsInclude TestMode = "include"
+)
+
+// ContinueOnParseErrors makes NewRepo (and the methods reading packages from
+// other revisions, such as Log) skip the .go files and nested go.mod files
+// that can't be parsed, rather than returning a *ParseError. The errors are
+// added to Repo.Warnings instead.
+func ContinueOnParseErrors() Option {
+	return func(r *Repo) {
+		r.continueOnParseErrors = true
+	}
+}
+
+// AllFiles makes Changes detect changes in all files, not only the source
+// files of packages (like allChanges in ChangesFrom).
+func AllFiles() Option {
+	return func(r *Repo) {
+		r.allFiles = true
+	}
+}
+
+// Ignore makes NewRepo skip, and Changes ignore changes to, the files and
+// directories matching any of the given patterns. Patterns are matched, as
+// in path.Match, against paths relative to the root of the repo (slash
+// separated) and against each of their parent directories, e.g.:
+// services/*/testdata. Patterns without a slash are matched against the
+// base name of the file and of each of its parent directories instead, as in
+// .gitignore: docs and *.md ignore them at any depth.
+func Ignore(patterns ...string) Option {
+	return func(r *Repo) {
+		r.ignore = append(r.ignore, patterns...)
+	}
+}
+
+// BuildContext makes NewRepo skip, and Changes ignore changes to, the .go
+// files excluded by ctxt, e.g. because of their build constraints or
+// GOOS/GOARCH suffixes.
+func BuildContext(ctxt *build.Context) Option {
+	return func(r *Repo) {
+		r.buildContext = ctxt
+	}
+}
+
+// Tests sets how Changes handles tests (TestsChange by default).
+func Tests(mode TestMode) Option {
+	return func(r *Repo) {
+		r.tests = mode
+	}
+}
+
+// Worktree makes Changes also detect uncommitted changes in the working
+// tree, including untracked files. Changed .go files in the working tree are
+// always considered API changes (see SemanticDiff, APISurface and
+// SymbolLevel).
+func Worktree() Option {
+	return func(r *Repo) {
+		r.worktree = true
+	}
+}
+
+// MergeBase makes Changes compare the target revision (HEAD by default) with
+// its merge base with the given revision, like git diff revision...HEAD,
+// rather than with the revision itself.
+func MergeBase() Option {
+	return func(r *Repo) {
+		r.mergeBase = true
+	}
+}
+
+// Target makes NewRepo read the packages at the given revision, rather than
+// from the working tree, and Changes detect the changes between the given
+// revision and the target one, rather than HEAD. It can't be used with
+// Worktree.
+func Target(revision string) Option {
+	return func(r *Repo) {
+		r.target = revision
+	}
+}
+
+// SemanticDiff makes Changes ignore changes to .go files that only touch
+// comments or formatting. Changes to directives (e.g. //go:embed) are still
+// considered changes.
+func SemanticDiff() Option {
+	return func(r *Repo) {
+		r.semanticDiff = true
+	}
+}
+
+// APISurface makes Changes compare the exported API of packages with changed
+// .go files. Packages whose API didn't change are flagged as
+// ChangedImplementation and their dependants as AffectedRebuildOnly.
+func APISurface() Option {
+	return func(r *Repo) {
+		r.apiSurface = true
+	}
+}
+
+// SymbolLevel makes Changes work out which top level declarations changed in
+// packages with changed .go files, and only flag dependants referencing them
+// (directly or through their own declarations). It takes precedence over
+// APISurface.
+func SymbolLevel() Option {
+	return func(r *Repo) {
+		r.symbolLevel = true
+	}
+}
+
+// ModCache sets the path to the module cache (e.g. the output of go env
+// GOMODCACHE). When a dependency version changes and both versions can be
+// found in the module cache, only the packages of that dependency which
+// actually changed are flagged, rather than the whole module.
+func ModCache(dir string) Option {
+	return func(r *Repo) {
+		r.modCache = dir
+	}
+}
+
+// ModGraph sets the path to a file containing the output of go mod graph.
+// Packages importing modules that require a changed module, directly or
+// transitively, are then flagged as changed too (which ModCache does as well,
+// reading the graph from the module cache).
+func ModGraph(file string) Option {
+	return func(r *Repo) {
+		r.modGraph = file
+	}
+}
+
+// OnMissingBase decides what Changes does when the given revision can't be
+// found (e.g. in shallow clones) or when its go.mod file can't be parsed
+// (MissingBaseError by default).
+func OnMissingBase(policy MissingBasePolicy) Option {
+	return func(r *Repo) {
+		r.onMissingBase = policy
+	}
+}
+
+// Logger makes NewRepo and Changes log what they do to logger.
+func Logger(logger *log.Logger) Option {
+	return func(r *Repo) {
+		r.logger = logger
+	}
+}
+
+// validateOptions returns an error if the options r was created with
+// conflict with each other.
+func (r *Repo) validateOptions() error {
+	switch r.tests {
+	case "", TestsChange, TestsIgnore, TestsInclude:
+	default:
+		return fmt.Errorf("invalid test mode %q", r.tests)
+	}
+
+	switch r.vcsBackend {
+	case "", VCSGoGit, VCSGit:
+	default:
+		return fmt.Errorf("invalid VCS backend %q", r.vcsBackend)
+	}
+
+	switch r.onMissingBase {
+	case "", MissingBaseError, MissingBaseAll, MissingBaseNone:
+	default:
+		return fmt.Errorf("invalid missing base policy %q", r.onMissingBase)
+	}
+
+	for _, pattern := range r.ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+
+	if r.worktree && r.target != "" {
+		return fmt.Errorf("working tree changes can't be detected with a target revision")
+	}
+
+	return nil
+}
+
+// logf logs to the logger set with Logger, if any.
+func (r *Repo) logf(format string, args ...interface{}) {
+	if r.logger != nil {
+		r.logger.Printf(format, args...)
+	}
+}
+
+// ignored returns true if the file or directory with the given name
+// (relative to the repo root and slash separated) matches any of the
+// patterns set with Ignore.
+func (r *Repo) ignored(name string) bool {
+	if len(r.ignore) == 0 {
+		return false
+	}
+
+	for name != "." && name != "/" && name != "" {
+		for _, pattern := range r.ignore {
+			target := name
+			if !strings.Contains(pattern, "/") {
+				target = path.Base(name)
+			}
+			if matched, _ := path.Match(pattern, target); matched {
+				return true
+			}
+		}
+		name = path.Dir(name)
+	}
+	return false
+}
+
+// ignoredTest returns true if name is a test file whose changes are ignored.
+func (r *Repo) ignoredTest(name string) bool {
+	return r.tests == TestsIgnore && strings.HasSuffix(name, "_test.go")
+}
+
+// matchesBuildContext returns true if the .go file with the given name
+// (relative to the repo root and slash separated) and contents is part of
+// the build according to the context set with BuildContext, if any.
+func (r *Repo) matchesBuildContext(name string, contents []byte) bool {
+	if r.buildContext == nil {
+		return true
+	}
+
+	ctxt := *r.buildContext
+	ctxt.OpenFile = func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(contents)), nil
+	}
+
+	match, err := ctxt.MatchFile(path.Dir(name), path.Base(name))
+	// files that can't be read are kept, parsing them will tell what's wrong
+	return match || err != nil
+}
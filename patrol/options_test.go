@@ -0,0 +1,187 @@
+package patrol_test
+
+import (
+	"bytes"
+	"context"
+	"go/build"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestOptions(t *testing.T) {
+	tmp, commits := newTestRepo(t,
+		"testdata/options/commits/1",
+		"testdata/options/commits/2",
+		"testdata/options/commits/3",
+	)
+
+	linux := build.Default
+	linux.GOOS = "linux"
+
+	const module = "github.com/utilitywarehouse/options"
+
+	tests := []struct {
+		name     string
+		options  []patrol.Option
+		from     string
+		expected []string
+	}{
+		{
+			name:    "ignore",
+			options: []patrol.Option{patrol.Ignore("generated", "*/baz/*_test.go")},
+			from:    commits[0],
+			expected: []string{
+				module + "/cmd/app",
+				module + "/pkg/foo",
+				module + "/pkg/qux",
+			},
+		},
+		{
+			name:    "build context",
+			options: []patrol.Option{patrol.BuildContext(&linux)},
+			from:    commits[0],
+			expected: []string{
+				module + "/cmd/app",
+				module + "/pkg/baz",
+				module + "/pkg/qux",
+				module + "/generated",
+			},
+		},
+		{
+			name:    "tests ignored",
+			options: []patrol.Option{patrol.Tests(patrol.TestsIgnore)},
+			from:    commits[0],
+			expected: []string{
+				module + "/cmd/app",
+				module + "/pkg/foo",
+				module + "/pkg/qux",
+				module + "/generated",
+			},
+		},
+		{
+			name:    "tests included",
+			options: []patrol.Option{patrol.Tests(patrol.TestsInclude)},
+			from:    commits[1],
+			expected: []string{
+				module + "/cmd/app",
+				module + "/pkg/baz",
+				module + "/pkg/qux",
+			},
+		},
+		{
+			name:     "target",
+			options:  []patrol.Option{patrol.Target(commits[1])},
+			from:     commits[1],
+			expected: nil,
+		},
+		{
+			name:     "merge base",
+			options:  []patrol.Option{patrol.Target(commits[0]), patrol.MergeBase()},
+			from:     commits[2],
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, err := patrol.NewRepo(tmp, test.options...)
+			require.NoError(t, err)
+
+			changes, err := repo.Changes(context.Background(), test.from)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.expected, changes)
+		})
+	}
+
+	t.Run("worktree", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "pkg", "foo", "foo.go"),
+			[]byte("package foo\n\nfunc Foo() {\n\tprintln(\"foo\")\n}\n"), 0o644))
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		changes, err := repo.Changes(context.Background(), commits[2])
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+
+		repo, err = patrol.NewRepo(tmp, patrol.Worktree())
+		require.NoError(t, err)
+
+		changes, err = repo.Changes(context.Background(), commits[2])
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{module + "/cmd/app", module + "/pkg/foo"}, changes)
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		repo, err := patrol.NewRepo(tmp, patrol.Logger(log.New(&buf, "", 0)))
+		require.NoError(t, err)
+
+		_, err = repo.Changes(context.Background(), commits[1])
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "pkg/qux/qux.go changed, flagging "+module+"/pkg/qux")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := patrol.NewRepoContext(ctx, tmp)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		_, err = repo.Changes(ctx, commits[0])
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("conflicting options", func(t *testing.T) {
+		_, err := patrol.NewRepo(tmp, patrol.Worktree(), patrol.Target(commits[0]))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid missing base policy", func(t *testing.T) {
+		_, err := patrol.NewRepo(tmp, patrol.OnMissingBase("ignore"))
+		assert.Error(t, err)
+	})
+}
+
+func TestIgnoreNestedFiles(t *testing.T) {
+	tmp, commits := newTestRepo(t,
+		"testdata/ignore/commits/1",
+		"testdata/ignore/commits/2",
+	)
+
+	const pkg = "github.com/utilitywarehouse/ignore/pkg/a"
+
+	tests := []struct {
+		name     string
+		ignore   []string
+		expected []string
+	}{
+		{name: "no patterns", expected: []string{pkg}},
+		{name: "base name", ignore: []string{"*.md"}},
+		{name: "directory name", ignore: []string{"a"}},
+		{name: "root path", ignore: []string{"pkg/*.md"}, expected: []string{pkg}},
+		{name: "nested path", ignore: []string{"pkg/*/README.md"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, err := patrol.NewRepo(tmp, patrol.AllFiles(), patrol.Ignore(test.ignore...))
+			require.NoError(t, err)
+
+			changes, err := repo.Changes(context.Background(), commits[0])
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.expected, changes)
+		})
+	}
+}
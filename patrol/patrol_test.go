@@ -31,6 +31,32 @@ type RepoTest struct {
 
 	// is this test for go files only or for all files?
 	AllFiles bool
+
+	// should changes to comments and formatting be ignored?
+	SemanticDiff bool
+
+	// should the exported API of changed packages be compared? If so, the
+	// expected changes also list the kind of change, e.g.:
+	// github.com/org/repo/pkg changed (implementation)
+	APISurface bool
+
+	// should changes be propagated only to dependants using changed
+	// declarations?
+	SymbolLevel bool
+
+	// should the module cache in testdata/{TestdataFolder}/modcache be used
+	// to find changes in dependencies?
+	ModCache bool
+
+	// should the go mod graph output in testdata/{TestdataFolder}/modgraph.txt
+	// be used to find modules requiring changed dependencies?
+	ModGraph bool
+
+	// what should happen if the base revision or its go.mod can't be found?
+	OnMissingBase patrol.MissingBasePolicy
+
+	// which backend should changes be detected with? Set by RepoTests.Run
+	VCS patrol.VCSBackend
 }
 
 func (test *RepoTest) Run(t *testing.T) {
@@ -74,11 +100,39 @@ func (test *RepoTest) Run(t *testing.T) {
 		if previousCommit != "" {
 			expected := expectedChanges(t, tmp)
 
-			r, err := patrol.NewRepo(tmp)
+			options := []patrol.Option{
+				patrol.VCS(test.VCS),
+				patrol.OnMissingBase(test.OnMissingBase),
+			}
+			if test.SemanticDiff {
+				options = append(options, patrol.SemanticDiff())
+			}
+			if test.APISurface {
+				options = append(options, patrol.APISurface())
+			}
+			if test.SymbolLevel {
+				options = append(options, patrol.SymbolLevel())
+			}
+			if test.ModCache {
+				modCache, err := filepath.Abs(filepath.Join("testdata", test.TestdataFolder, "modcache"))
+				require.NoError(t, err)
+				options = append(options, patrol.ModCache(modCache))
+			}
+			if test.ModGraph {
+				options = append(options, patrol.ModGraph(filepath.Join("testdata", test.TestdataFolder, "modgraph.txt")))
+			}
+
+			r, err := patrol.NewRepo(tmp, options...)
 			require.NoError(t, err)
 
 			changes, err := r.ChangesFrom(previousCommit, test.AllFiles)
 			require.NoError(t, err)
+
+			if test.APISurface {
+				for i, c := range changes {
+					changes[i] = c + " " + r.Packages[c].ChangeKind.String()
+				}
+			}
 			assert.ElementsMatch(t, expected, changes, test.Name+": expected changes do not match")
 		}
 
@@ -86,6 +140,37 @@ func (test *RepoTest) Run(t *testing.T) {
 	}
 }
 
+// newTestRepo creates a git repository with one commit for each of the given
+// directories, each commit applied on top of the previous one. It returns the
+// path to the repository and the hashes of the commits.
+func newTestRepo(t *testing.T, dirs ...string) (string, []string) {
+	tmp := t.TempDir()
+
+	repo, err := git.PlainInit(tmp, false)
+	require.NoError(t, err)
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	var commits []string
+	for i, dir := range dirs {
+		require.NoError(t, copy(dir, tmp))
+		require.NoError(t, worktree.AddGlob("."))
+
+		commit, err := worktree.Commit(fmt.Sprintf("commit #%v", i+1), &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "patrol test",
+				Email: "patrol@test.me",
+				When:  time.Now(),
+			},
+		})
+		require.NoError(t, err)
+		commits = append(commits, commit.String())
+	}
+
+	return tmp, commits
+}
+
 func expectedChanges(t *testing.T, dir string) []string {
 	file, err := os.Open(filepath.Join(dir, "changes.patrol"))
 	require.NoError(t, err)
@@ -104,10 +189,16 @@ func expectedChanges(t *testing.T, dir string) []string {
 
 type RepoTests []RepoTest
 
+// Run runs each test with each of the VCS backends.
 func (tests RepoTests) Run(t *testing.T) {
-	for _, test := range tests {
-		t.Run(test.Name, func(t *testing.T) {
-			test.Run(t)
+	for _, backend := range []patrol.VCSBackend{patrol.VCSGoGit, patrol.VCSGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			for _, test := range tests {
+				test.VCS = backend
+				t.Run(test.Name, func(t *testing.T) {
+					test.Run(t)
+				})
+			}
 		})
 	}
 }
@@ -1,16 +1,21 @@
 package patrol
 
 import (
-	"go/parser"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
 	"go/token"
-	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
-	git "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"golang.org/x/mod/modfile"
 )
 
@@ -18,9 +23,69 @@ type Repo struct {
 	path   string
 	Module *modfile.File
 
+	// map of the modules nested within the repo, with the module directory
+	// relative to the repo root as key and the module path as value
+	modules map[string]string
+
 	// map of packages, with the package name as key (e.g.:
 	// github.com/uw-labs/patrol/patrol)
 	Packages map[string]*Package
+
+	// tree the packages were read from, nil if they were read from the
+	// working tree (changes are then detected between HEAD and the given
+	// revision)
+	tree *object.Tree
+
+	// map of the packages read from tree (or the working tree), with their
+	// directory as key
+	sources map[string][]sourcePackage
+
+	// symlinks found in the repo, with their name as key and the name of the
+	// file or directory they point to as value (both relative to the repo
+	// root), if it's within the repo
+	symlinks map[string]string
+
+	// symlinks (see above) pointing to directories
+	linkedDirs map[string]bool
+
+	// pkg-config files found in the repo, with the package they define as
+	// key and the files and directories they refer to as value (see
+	// parsePkgConfig)
+	pkgConfigs map[string][]string
+
+	// map of the modules required in go.mod that changed, with the packages
+	// flagged as changed because of each of them
+	changedModules map[string][]string
+
+	// Warnings lists the problems that were skipped while reading the repo,
+	// such as the files that couldn't be parsed (as *ParseError) when
+	// ContinueOnParseErrors is used.
+	Warnings []error
+
+	// hash of the commit tree was read from
+	commit string
+
+	// backends opened to read from git, see openVCS and openGoGit
+	vcs   vcs
+	goGit *goGit
+
+	// options NewRepo was called with (see Option)
+	vcsBackend            VCSBackend
+	continueOnParseErrors bool
+	allFiles              bool
+	ignore                []string
+	buildContext          *build.Context
+	tests                 TestMode
+	worktree              bool
+	mergeBase             bool
+	target                string
+	logger                *log.Logger
+	semanticDiff          bool
+	apiSurface            bool
+	symbolLevel           bool
+	modCache              string
+	modGraph              string
+	onMissingBase         MissingBasePolicy
 }
 
 type Package struct {
@@ -28,83 +93,215 @@ type Package struct {
 	PartOfModule bool
 	Dependants   []*Package
 	Changed      bool
+
+	// Imports lists the packages imported by the package (by its non test
+	// files), in the order they're first imported. It's only populated for
+	// packages found in the repo.
+	Imports []Import
+
+	// Dir is the directory of the package, relative to the root of the repo
+	// and slash separated (e.g.: services/foo/cmd/foo). It's empty for
+	// packages that are not in the repo, such as external modules.
+	Dir string
+
+	// Main is true for commands (packages named main).
+	Main bool
+
+	// ChangeKind describes how the package was affected by the changes
+	// detected by ChangesFrom.
+	ChangeKind ChangeKind
+
+	// Reason is set when the package was flagged as changed because changes
+	// couldn't be detected (see OnMissingBase), e.g.: "base revision not
+	// found".
+	Reason string
+
+	// direct is true if the package itself changed, rather than only being
+	// affected by changes to its dependencies
+	direct bool
+}
+
+// sourcePackage is a package found in a directory of the repo, with the
+// packages imported by its non test files.
+type sourcePackage struct {
+	name    string
+	imports []string
+
+	// files and directories (relative to the repo root), and pkg-config
+	// packages, its #cgo directives refer to, sorted
+	cgo       []string
+	pkgConfig []string
+
+	// positions of the imports of all its files, test files included
+	positions []importPosition
 }
 
 // NewRepo constructs a Repo from path, which needs to contain a go.mod file.
 // It builds a map of all packages found in that repo and the dependencies
-// between them.
-func NewRepo(path string) (*Repo, error) {
+// between them. It returns an error wrapping ErrGoModNotFound if there's no
+// go.mod file, and a *ParseError if any .go or go.mod file can't be parsed
+// (see ContinueOnParseErrors).
+func NewRepo(path string, options ...Option) (*Repo, error) {
+	return NewRepoContext(context.Background(), path, options...)
+}
+
+// NewRepoContext is like NewRepo, but stops reading the repo (returning
+// ctx.Err()) once ctx is done.
+func NewRepoContext(ctx context.Context, path string, options ...Option) (*Repo, error) {
 	repo := &Repo{
 		path:     path,
 		Packages: map[string]*Package{},
 	}
+	for _, option := range options {
+		option(repo)
+	}
+	if err := repo.validateOptions(); err != nil {
+		return nil, err
+	}
+
+	if repo.target != "" {
+		if err := repo.loadTarget(); err != nil {
+			return nil, err
+		}
+		repo.logf("read %d packages from %s", len(repo.Packages), repo.target)
+		return repo, nil
+	}
 
 	// Parse go.mod
 	b, err := os.ReadFile(filepath.Join(path, "go.mod"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrGoModNotFound, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	mod, err := modfile.Parse(filepath.Join(path, "go.mod"), b, nil)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Path: "go.mod", Err: err}
 	}
 
 	repo.Module = mod
+	repo.modules = map[string]string{}
+	repo.symlinks = map[string]string{}
+	repo.linkedDirs = map[string]bool{}
+	repo.pkgConfigs = map[string][]string{}
+	sources := map[string][]sourcePackage{}
 
 	// Find all go packages starting from path
-	err = filepath.Walk(path, func(p string, f os.FileInfo, err error) error {
-		if f.IsDir() && !directoryShouldBeIgnored(p) {
-			fset := token.NewFileSet()
+	err = repo.readSourceDirs(ctx, path, ".", map[string]bool{}, sources)
+	if err != nil {
+		return nil, err
+	}
 
-			// We're interested in each package imports at this point
-			pkgs, err := parser.ParseDir(fset, p, nil, parser.ImportsOnly)
-			if err != nil {
-				return err
-			}
+	repo.sources = sources
+	repo.addPackages(sources)
+	repo.logf("read %d packages from %s", len(repo.Packages), path)
 
-			for _, pkg := range pkgs {
-				if len(pkg.Files) == 0 {
-					continue
-				}
+	return repo, nil
+}
 
-				var imports []string
-				for _, file := range pkg.Files {
-					// Don't map test packages
-					if !strings.HasSuffix(file.Name.Name, "_test") {
-						for _, imp := range file.Imports {
-							imports = append(imports, strings.ReplaceAll(imp.Path.Value, `"`, ""))
-						}
-					}
-				}
-				repo.addPackage(strings.TrimPrefix(p, path+"/"), imports)
-			}
-		}
-		return nil
-	})
+// LoadRevision reads the packages of the repo from the given revision, as if
+// r had been created with Target(revision): changes are then detected in that
+// revision. Only the directories with .go files that differ from the revision
+// previously loaded (if any) are parsed again, and the working tree isn't
+// read, so one Repo can be used to analyse many revisions. Flagged changes
+// are reset.
+func (r *Repo) LoadRevision(revision string) error {
+	if r.worktree {
+		return fmt.Errorf("working tree changes can't be detected with a target revision")
+	}
+
+	r.target = revision
+	return r.loadTarget()
+}
+
+// loadTarget reads the packages of the repo from the target revision (see
+// Target).
+func (r *Repo) loadTarget() error {
+	g, err := r.openGoGit()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return repo, nil
+	commit, err := g.resolveCommit(r.target)
+	if err != nil {
+		return err
+	}
+
+	tree, err := g.tree(commit.Hash.String())
+	if err != nil {
+		return err
+	}
+
+	r.commit = commit.Hash.String()
+	return r.loadTree(tree)
 }
 
 // ChangesFrom returns a list of all packages within the repository (excluding
 // packages in vendor/) that changed since the given revision. A package will
 // be flagged as change if any file within the package itself changed or if any
 // packages it imports (whether local, vendored or external modules) changed
-// since the given revision. If allChanges is false it will be only concerned about changes in .go files.
+// since the given revision. If allChanges is false it will be only concerned about changes in .go files
+// (and other files the go tool compiles, such as .c or .s files, or files #cgo directives refer to).
+// If the revision can't be found the error wraps ErrRevisionNotFound, and if
+// its go.mod file is missing or invalid ErrInvalidBaseGoMod (unless
+// OnMissingBase says otherwise).
+//
+// The options r was created with apply, except for AllFiles, which is
+// replaced by allChanges.
 func (r *Repo) ChangesFrom(revision string, allChanges bool) ([]string, error) {
-	err := r.detectInternalChangesFrom(revision, allChanges)
+	return r.changesFrom(context.Background(), revision, allChanges)
+}
+
+// Changes is like ChangesFrom, with AllFiles deciding whether all files or
+// only source files are considered, but stops (returning ctx.Err()) once ctx is
+// done.
+func (r *Repo) Changes(ctx context.Context, revision string) ([]string, error) {
+	return r.changesFrom(ctx, revision, r.allFiles)
+}
+
+func (r *Repo) changesFrom(ctx context.Context, revision string, allFiles bool) ([]string, error) {
+	v, err := r.openVCS()
 	if err != nil {
 		return nil, err
 	}
 
-	err = r.detectGoModulesChanges(revision)
-	if err != nil {
+	if r.mergeBase {
+		base, err := r.mergeBaseWith(ctx, v, revision)
+		if err != nil {
+			if err = r.applyMissingBasePolicy(err); err != nil {
+				return nil, err
+			}
+			return r.changedOwnedPackages(), nil
+		}
+		r.logf("using merge base %s of %s", base, revision)
+		revision = base
+	}
+
+	err = r.detectInternalChangesFrom(ctx, v, revision, allFiles)
+	if err = r.applyMissingBasePolicy(err); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	oldGoMod, err := r.getGoModFromRevision(ctx, v, revision)
+	if err == nil {
+		err = r.detectGoModulesChanges(oldGoMod)
+	}
+	if err = r.applyMissingBasePolicy(err); err != nil {
 		return nil, err
 	}
 
+	return r.changedOwnedPackages(), nil
+}
+
+// changedOwnedPackages returns the names of the packages within the repo
+// flagged as changed.
+func (r *Repo) changedOwnedPackages() []string {
 	var changedOwnedPackages []string
 	for _, pkg := range r.Packages {
 		if pkg.PartOfModule && pkg.Changed {
@@ -112,26 +309,287 @@ func (r *Repo) ChangesFrom(revision string, allChanges bool) ([]string, error) {
 		}
 	}
 
-	return changedOwnedPackages, nil
+	return changedOwnedPackages
+}
+
+// mergeBaseWith returns the best common ancestor of revision and the commit
+// changes are detected in (see headRevision).
+func (r *Repo) mergeBaseWith(ctx context.Context, v vcs, revision string) (string, error) {
+	now, err := r.headRevision(ctx, v)
+	if err != nil {
+		return "", err
+	}
+
+	then, err := v.resolveRevision(ctx, revision)
+	if err != nil {
+		return "", err
+	}
+
+	base, err := v.mergeBase(ctx, now, then)
+	if err != nil {
+		return "", err
+	}
+
+	if base == "" {
+		return "", fmt.Errorf("no merge base found between %s and %s", now, revision)
+	}
+
+	return base, nil
+}
+
+// readSourceDirs reads the packages in the directory at p (dir relative to the
+// repo root) and in its subdirectories into sources, following symlinks.
+// ancestors holds the real paths of the directories being read, so that
+// symlinks pointing to any of them aren't followed again.
+func (r *Repo) readSourceDirs(ctx context.Context, p, dir string, ancestors map[string]bool, sources map[string][]sourcePackage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if directoryShouldBeIgnored(p) || r.ignored(dir) {
+		return nil
+	}
+
+	realPath, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return err
+	}
+	if ancestors[realPath] {
+		r.logf("not following %s, it points to one of its parents", dir)
+		return nil
+	}
+	ancestors[realPath] = true
+	defer delete(ancestors, realPath)
+
+	// packages in nested modules are named after those modules, the go
+	// command ignores testdata directories so modules in there are too
+	if dir != "." && !inTestdata(dir) {
+		if err := r.addNestedModule(p, dir); err != nil {
+			return err
+		}
+	}
+
+	// We're interested in each package imports at this point
+	pkgs, err := r.parseSourceDir(p, dir)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) > 0 {
+		sources[dir] = pkgs
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath, entryDir := filepath.Join(p, entry.Name()), path.Join(dir, entry.Name())
+
+		isDir := entry.IsDir()
+		if !isDir && path.Ext(entry.Name()) == ".pc" {
+			contents, err := os.ReadFile(entryPath)
+			if err != nil {
+				return err
+			}
+			r.addPkgConfig(entryDir, contents)
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(entryPath)
+			if err != nil {
+				// dangling symlinks point to nothing to read
+				continue
+			}
+			if err := r.addSymlink(entryPath, entryDir, info.IsDir()); err != nil {
+				return err
+			}
+			isDir = info.IsDir()
+		}
+
+		if isDir {
+			if err := r.readSourceDirs(ctx, entryPath, entryDir, ancestors, sources); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addNestedModule records the module defined in dir (relative to the repo
+// root), if dir contains a go.mod file.
+func (r *Repo) addNestedModule(path, dir string) error {
+	b, err := os.ReadFile(filepath.Join(path, "go.mod"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	mod, err := modfile.ParseLax(filepath.Join(path, "go.mod"), b, nil)
+	if err != nil {
+		return r.parseError(dir+"/go.mod", err)
+	}
+	if mod.Module == nil {
+		return nil
+	}
+
+	r.modules[dir] = mod.Module.Mod.Path
+	return nil
+}
+
+// parseSourceDir parses the imports of the .go files in the directory at p
+// (dir relative to the repo root) and groups them by package.
+func (r *Repo) parseSourceDir(p, dir string) ([]sourcePackage, error) {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+
+	var sources []sourcePackage
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+
+		name := path.Join(dir, entry.Name())
+		if r.ignored(name) {
+			continue
+		}
+
+		src, err := os.ReadFile(filepath.Join(p, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if !r.matchesBuildContext(name, src) {
+			continue
+		}
+
+		file, err := parseImports(fset, name, src)
+		if err != nil {
+			if err := r.parseError(name, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		sources, err = r.addSourceFile(sources, fset, file, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sources, nil
+}
+
+// addSourceFile adds the imports of file (parsed with fset) to the package it
+// belongs to in sources, adding the package if it's not there yet. Imports of
+// test packages are ignored, unless tests are included (see Tests), but their
+// positions are recorded anyway.
+func (r *Repo) addSourceFile(sources []sourcePackage, fset *token.FileSet, file *ast.File, dir string) ([]sourcePackage, error) {
+	i := 0
+	for i < len(sources) && sources[i].name != file.Name.Name {
+		i++
+	}
+	if i == len(sources) {
+		sources = append(sources, sourcePackage{name: file.Name.Name})
+	}
+
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		position := fset.Position(imp.Pos())
+		sources[i].positions = append(sources[i].positions, importPosition{
+			path:     importPath,
+			position: position,
+			test:     strings.HasSuffix(position.Filename, "_test.go"),
+			external: strings.HasSuffix(file.Name.Name, "_test"),
+		})
+	}
+
+	// Don't map test packages
+	if strings.HasSuffix(file.Name.Name, "_test") && r.tests != TestsInclude {
+		return sources, nil
+	}
+
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		sources[i].imports = append(sources[i].imports, importPath)
+	}
+	addCgoDirectives(&sources[i], file, dir)
+
+	return sources, nil
 }
 
-// addPackage adds the package found at path to the repo, and also adds it as a
-// dependant to all of the packages it imports.
-func (r *Repo) addPackage(path string, imports []string) {
-	var pkgName string
+// inTestdata returns true if dir (slash separated) is or is within a
+// testdata directory.
+func inTestdata(dir string) bool {
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "testdata" {
+			return true
+		}
+	}
+	return false
+}
 
-	// if path has vendor/ prefix, that needs to be removed to get the actual
+// packageName returns the name of the package in dir, relative to the repo
+// root and slash separated.
+func (r *Repo) packageName(dir string) string {
+	// if dir has vendor/ prefix, that needs to be removed to get the actual
 	// package name
-	if strings.HasPrefix(path, "vendor/") {
-		pkgName = strings.TrimPrefix(path, "vendor/")
-	} else {
-		// if it doesn't have a vendor/ prefix it means it's part of our module and
-		// path should be prefixed with the module name.
-		pkgName = r.ModuleName()
-		if path != r.path {
-			pkgName += "/" + path
+	if strings.HasPrefix(dir, "vendor/") {
+		return strings.TrimPrefix(dir, "vendor/")
+	}
+
+	// otherwise it's part of our module (or a nested one) and the path should
+	// be prefixed with the module name
+	for moduleDir := dir; moduleDir != "."; moduleDir = path.Dir(moduleDir) {
+		if modulePath, ok := r.modules[moduleDir]; ok {
+			return path.Join(modulePath, strings.TrimPrefix(dir, moduleDir))
 		}
 	}
+	return path.Join(r.ModuleName(), dir)
+}
+
+// addPackages adds the given packages (a map of directory to the packages
+// found in it) to the repo.
+func (r *Repo) addPackages(sources map[string][]sourcePackage) {
+	dirs := make([]string, 0, len(sources))
+	for dir := range sources {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		for _, src := range sources[dir] {
+			added := r.addPackage(dir, src.imports)
+			if src.name == "main" {
+				added.Main = true
+			}
+		}
+	}
+
+	// imports can only be classified once all packages (e.g. vendored ones)
+	// were added
+	for _, pkg := range r.Packages {
+		for i := range pkg.Imports {
+			r.classifyImport(&pkg.Imports[i])
+		}
+	}
+}
+
+// addPackage adds the package found at dir (relative to the repo root) to the
+// repo, and also adds it as a dependant to all of the packages it imports.
+func (r *Repo) addPackage(dir string, imports []string) *Package {
+	pkgName := r.packageName(dir)
 
 	// add the new package to the repo if it didn't exist already
 	pkg, exists := r.Packages[pkgName]
@@ -142,16 +600,22 @@ func (r *Repo) addPackage(path string, imports []string) {
 		}
 		r.Packages[pkgName] = pkg
 	}
+	pkg.Dir = dir
 
 	// imports might not be a unique list, but we only want to add pkg as a
 	// dependant to those packages once
 	alreadyProcessedImports := map[string]interface{}{}
+	for _, imp := range pkg.Imports {
+		// the imports of the package's tests (see Tests) are added separately
+		alreadyProcessedImports[imp.Package.Name] = struct{}{}
+	}
 	for _, dependency := range imports {
-		if _, alreadyProcessed := alreadyProcessedImports[dependency]; alreadyProcessed {
+		if _, alreadyProcessed := alreadyProcessedImports[dependency]; alreadyProcessed || dependency == pkgName {
 			continue
 		}
 		r.addDependant(pkg, dependency)
 		alreadyProcessedImports[dependency] = struct{}{}
+		pkg.addImport(r.Packages[dependency])
 
 		// if the dependency is part of an external dependency (defined in go.mod)
 		// add the parent module as a dependency as well so that a simple version
@@ -164,18 +628,25 @@ func (r *Repo) addPackage(path string, imports []string) {
 			alreadyProcessedImports[parent] = struct{}{}
 		}
 	}
+
+	return pkg
 }
 
 // externalModule checks if the given package is part of one of the modules required
 // as dependencies in go.mod. If it is it returns the name of the parent
 // package and true.
 func (r *Repo) externalModule(pkg string) (string, bool) {
+	var parent string
 	for _, req := range r.Module.Require {
-		if strings.HasPrefix(pkg, req.Mod.Path) {
-			return req.Mod.Path, true
+		if pkg != req.Mod.Path && !strings.HasPrefix(pkg, req.Mod.Path+"/") {
+			continue
+		}
+		// nested modules (e.g. example.com/mod/sub) take precedence
+		if len(req.Mod.Path) > len(parent) {
+			parent = req.Mod.Path
 		}
 	}
-	return "", false
+	return parent, parent != ""
 }
 
 // addDependant adds dependant as one of the dependants of the package
@@ -197,199 +668,452 @@ func (r *Repo) addDependant(dependant *Package, dependencyName string) {
 // changed any packages (part of the module in the repo or vendored packages) that
 // have files that are part of that diff and packages that depend on them. If allFiles
 // is set to true, it checks for changes in all file types. If false, it only checks for
-// changes in *.go files.
-func (r *Repo) detectInternalChangesFrom(revision string, allFiles bool) error {
-	repo, err := git.PlainOpen(r.path)
+// changes in the files the go tool compiles (*.go, *.c, *.s...) and the ones #cgo directives
+// refer to.
+func (r *Repo) detectInternalChangesFrom(ctx context.Context, v vcs, revision string, allFiles bool) error {
+	now, err := r.headRevision(ctx, v)
 	if err != nil {
 		return err
 	}
 
-	head, err := repo.Head()
+	then, err := v.resolveRevision(ctx, revision)
 	if err != nil {
 		return err
 	}
 
-	// Get the HEAD commit
-	now, err := repo.CommitObject(head.Hash())
+	// Get a diff between the two commits
+	diff, err := v.changedFiles(ctx, then, now)
 	if err != nil {
 		return err
 	}
+	r.logf("%d files changed since %s", len(diff), revision)
 
-	// Get the tree for HEAD
-	nowTree, err := now.Tree()
-	if err != nil {
-		return err
+	cgoRefs := r.cgoReferences()
+
+	// map of packages that had .go files changed, with the package name as key
+	// and its directory as value
+	goPackages := map[string]string{}
+
+	for _, change := range diff {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if r.flagLinkedPackages(change.now) {
+			continue
+		}
+
+		if !r.ignored(change.now) {
+			r.flagCgoDependants(cgoRefs, change.now)
+		}
+
+		goFile := strings.HasSuffix(change.now, ".go")
+		if !r.considerChange(change.now, allFiles) {
+			continue
+		}
+
+		if r.isPackageSource(change.now) && r.buildContext != nil {
+			matches, err := r.changeMatchesBuildContext(ctx, v, now, change)
+			if err != nil {
+				return err
+			}
+			if !matches {
+				continue
+			}
+		}
+
+		if goFile && r.semanticDiff {
+			cosmetic, err := cosmeticChange(ctx, v, now, then, change)
+			if err != nil {
+				return err
+			}
+			if cosmetic {
+				continue
+			}
+		}
+
+		// the file might also be reached through symlinks, as part of other
+		// packages
+		for _, name := range append([]string{change.now}, r.aliases(change.now)...) {
+			if name != change.now && !r.considerChange(name, allFiles) {
+				continue
+			}
+
+			pkgName, err := r.changedFilePackage(name)
+			if err != nil {
+				return err
+			}
+
+			if goFile && (r.apiSurface || r.symbolLevel) {
+				// the files are read from where they actually are
+				goPackages[pkgName] = path.Dir(change.now)
+				continue
+			}
+
+			r.logf("%s changed, flagging %s", name, pkgName)
+			r.flagPackageAsChanged(pkgName, ChangedAPI)
+		}
 	}
 
-	ref, err := repo.ResolveRevision(plumbing.Revision(revision))
-	if err != nil {
-		return err
+	if r.worktree {
+		if err := r.detectWorktreeChanges(ctx, v, allFiles); err != nil {
+			return err
+		}
 	}
 
-	// Find the commit for given revision
-	then, err := repo.CommitObject(*ref)
-	if err != nil {
-		return err
+	if r.symbolLevel {
+		return r.flagChangedSymbols(ctx, v, now, then, goPackages)
+	}
+
+	for pkgName, dir := range goPackages {
+		apiChanged, err := apiChangedBetween(ctx, v, now, then, dir)
+		if err != nil {
+			return err
+		}
+
+		if apiChanged {
+			r.flagPackageAsChanged(pkgName, ChangedAPI)
+		} else {
+			r.flagPackageAsChanged(pkgName, ChangedImplementation)
+		}
+	}
+
+	return nil
+}
+
+// considerChange returns true if changes to the file with the given name
+// can flag packages as changed, according to allFiles and to the options r
+// was created with.
+func (r *Repo) considerChange(name string, allFiles bool) bool {
+	if !allFiles && !r.isPackageSource(name) {
+		// we're only interested in the files the go tool compiles
+		return false
+	}
+	return !r.ignored(name) && !r.ignoredTest(name)
+}
+
+// changedFilePackage returns the name of the package a changed file belongs
+// to.
+func (r *Repo) changedFilePackage(name string) (string, error) {
+	if r.isPackageSource(name) || strings.HasPrefix(name, "vendor/") {
+		// go files (and other files the go tool compiles) are always in
+		// packages, as well as vendored files
+		return r.packageName(path.Dir(name)), nil
 	}
 
-	// Get the tree for given revision
-	thenTree, err := then.Tree()
+	// Non go files belong to the closest package
+	return r.closestPackageForFileInModule(name)
+}
+
+// changeMatchesBuildContext returns true if the changed source file is part of
+// the build (see BuildContext) at now, the commit changes are detected in.
+func (r *Repo) changeMatchesBuildContext(ctx context.Context, v vcs, now string, change fileChange) (bool, error) {
+	if change.now == "" {
+		return true, nil
+	}
+
+	contents, err := v.readFile(ctx, now, change.now)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// Get a diff between the two trees
-	diff, err := nowTree.Diff(thenTree)
+	return r.matchesBuildContext(change.now, contents), nil
+}
+
+// detectWorktreeChanges flags as changed the packages with uncommitted
+// changes in the working tree (see Worktree).
+func (r *Repo) detectWorktreeChanges(ctx context.Context, v vcs, allFiles bool) error {
+	names, err := v.worktreeChanges(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, change := range diff {
-		goFile := strings.HasSuffix(change.From.Name, ".go")
-		if !allFiles && !goFile {
-			// we're only interested in Go files
+	return r.flagChangedFiles(ctx, names, allFiles)
+}
+
+// flagChangedFiles flags as changed the packages the files with the given
+// names belong to, reading them from the working tree if needed.
+func (r *Repo) flagChangedFiles(ctx context.Context, names []string, allFiles bool) error {
+	cgoRefs := r.cgoReferences()
+
+	for _, changed := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if r.flagLinkedPackages(changed) {
 			continue
 		}
 
-		var pkgName string
-		// if the changed file is in vendor/ stripping "vendor/" will give us the
-		// package name
-		if strings.HasPrefix(change.From.Name, "vendor/") {
-			pkgName = strings.TrimPrefix(filepath.Dir(change.From.Name), "vendor/")
+		if !r.ignored(changed) {
+			r.flagCgoDependants(cgoRefs, changed)
 		}
 
-		// package is part of our module
-		if pkgName == "" {
-			if goFile {
-				// go files are always in packages
-				pkgName = r.ModuleName() + "/" + filepath.Dir(change.From.Name)
+		for _, name := range append([]string{changed}, r.aliases(changed)...) {
+			if !r.considerChange(name, allFiles) {
+				continue
 			}
-			if allFiles && !goFile {
-				// Non go files belong to the closest package
-				pkgName, err = r.closestPackageForFileInModule(change.From.Name)
-				if err != nil {
-					return err
+
+			if r.isPackageSource(name) && r.buildContext != nil {
+				contents, err := os.ReadFile(filepath.Join(r.path, filepath.FromSlash(name)))
+				if err == nil && !r.matchesBuildContext(name, contents) {
+					continue
 				}
 			}
-		}
 
-		r.flagPackageAsChanged(pkgName)
+			pkgName, err := r.changedFilePackage(name)
+			if err != nil {
+				return err
+			}
+
+			r.logf("%s changed, flagging %s", name, pkgName)
+			r.flagPackageAsChanged(pkgName, ChangedAPI)
+		}
 	}
 
 	return nil
 }
 
+// headRevision returns the commit changes are detected in: the commit the
+// packages were read from (see Target), or HEAD if they were read from the
+// working tree.
+func (r *Repo) headRevision(ctx context.Context, v vcs) (string, error) {
+	if r.commit != "" {
+		return r.commit, nil
+	}
+	return v.resolveRevision(ctx, "HEAD")
+}
+
+// cosmeticChange returns true if change modified a Go file between the
+// commits then and now without changing its meaning (e.g. only comments or
+// formatting changed).
+func cosmeticChange(ctx context.Context, v vcs, now, then string, change fileChange) (bool, error) {
+	if change.now == "" || change.then == "" {
+		// file was either added or removed
+		return false, nil
+	}
+
+	nowContents, err := v.readFile(ctx, now, change.now)
+	if err != nil {
+		return false, err
+	}
+
+	thenContents, err := v.readFile(ctx, then, change.then)
+	if err != nil {
+		return false, err
+	}
+
+	return semanticallyEqual(thenContents, nowContents), nil
+}
+
 // closestPackageForFileInModule returns the closest go package path for the given file
-// it will return the module name if no package is found
+// it will return the name of the module the file is in if no package is found
 func (r *Repo) closestPackageForFileInModule(fileName string) (string, error) {
-	currentDir := filepath.Dir(fileName)
+	currentDir := path.Dir(fileName)
 	for currentDir != "." {
-		files, err := os.ReadDir(r.path + "/" + currentDir)
+		if _, isModule := r.modules[currentDir]; isModule {
+			break
+		}
+
+		hasGoFiles, err := r.hasGoFiles(currentDir)
 		if err != nil {
 			return "", err
 		}
+		if hasGoFiles {
+			return r.packageName(currentDir), nil
+		}
+
+		currentDir = path.Dir(currentDir)
+	}
+	return r.packageName(currentDir), nil
+}
+
+// hasGoFiles returns true if dir (relative to the repo root) contains any
+// .go file, in the tree the packages were read from.
+func (r *Repo) hasGoFiles(dir string) (bool, error) {
+	if r.tree != nil {
+		tree, err := r.tree.Tree(dir)
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
 
-		for _, f := range files {
-			if strings.HasSuffix(f.Name(), ".go") {
-				return r.ModuleName() + "/" + currentDir, nil
+		for _, entry := range tree.Entries {
+			if entry.Mode.IsFile() && strings.HasSuffix(entry.Name, ".go") {
+				return true, nil
 			}
 		}
+		return false, nil
+	}
 
-		currentDir = filepath.Dir(currentDir)
+	files, err := os.ReadDir(filepath.Join(r.path, filepath.FromSlash(dir)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
 	}
-	return r.ModuleName(), nil
+
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".go") {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // detectGoModulesChanges finds differences in dependencies required by
-// HEAD:go.mod and {revision}:go.mod and flags as changed any packages
+// go.mod and oldGoMod (e.g. {revision}:go.mod) and flags as changed any packages
 // depending on any of the changed dependencies.
-func (r *Repo) detectGoModulesChanges(revision string) error {
-	oldGoMod, err := r.getGoModFromRevision(revision)
+func (r *Repo) detectGoModulesChanges(oldGoMod *modfile.File) error {
+	graph, err := r.moduleGraph()
 	if err != nil {
 		return err
 	}
 
 	differentModules := goModDifferences(oldGoMod, r.Module)
 	for _, module := range differentModules {
-		r.flagPackageAsChanged(module)
+		packages := []string{module}
+		if r.modCache != "" {
+			changedPackages, ok, err := changedModulePackages(r.modCache, module,
+				requiredVersion(oldGoMod, module), requiredVersion(r.Module, module))
+			if err != nil {
+				return err
+			}
+			if ok {
+				packages = changedPackages
+			}
+		}
+
+		if len(packages) == 0 {
+			// nothing changed that could affect importers or modules
+			// requiring it
+			continue
+		}
+
+		// modules requiring the changed module might be using it in the
+		// packages we import, even if we don't import it ourselves
+		for _, requirer := range graph.requirers(module) {
+			if requirer != r.ModuleName() {
+				packages = append(packages, requirer)
+			}
+		}
+
+		for _, pkg := range packages {
+			r.flagPackageAsChanged(pkg, ChangedAPI)
+		}
+
+		if r.changedModules == nil {
+			r.changedModules = map[string][]string{}
+		}
+		r.changedModules[module] = packages
 	}
 
 	return nil
 }
 
-// getGoModFromRevision returns (if found) the go.mod file from the given
-// revision.
-func (r *Repo) getGoModFromRevision(revision string) (*modfile.File, error) {
-	repo, err := git.PlainOpen(r.path)
-	if err != nil {
-		return nil, err
+// moduleGraph returns the graph of the modules required by the repo, either
+// read from ModGraph or built from the go.mod files in ModCache. It returns
+// an empty graph if neither is set.
+func (r *Repo) moduleGraph() (moduleGraph, error) {
+	if r.modGraph != "" {
+		return readModuleGraph(r.modGraph)
 	}
 
-	ref, err := repo.ResolveRevision(plumbing.Revision(revision))
-	if err != nil {
-		return nil, err
+	if r.modCache != "" {
+		return moduleGraphFromCache(r.modCache, r.Module)
 	}
 
-	then, err := repo.CommitObject(*ref)
-	if err != nil {
-		return nil, err
-	}
+	return moduleGraph{}, nil
+}
 
-	file, err := then.File("go.mod")
-	if err != nil {
-		return nil, err
+// requiredVersion returns the version of the given module required in the
+// go.mod file, or an empty string if it isn't required.
+func requiredVersion(mod *modfile.File, path string) string {
+	for _, r := range mod.Require {
+		if r.Mod.Path == path {
+			return r.Mod.Version
+		}
 	}
+	return ""
+}
 
-	reader, err := file.Reader()
+// getGoModFromRevision returns (if found) the go.mod file from the given
+// revision.
+func (r *Repo) getGoModFromRevision(ctx context.Context, v vcs, revision string) (*modfile.File, error) {
+	then, err := v.resolveRevision(ctx, revision)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if err := reader.Close(); err != nil {
-			log.Println("failed to close reader:", err)
-		}
-	}()
-
-	b, err := ioutil.ReadAll(reader)
+	b, err := v.readFile(ctx, then, "go.mod")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBaseGoMod, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	return r.parseBaseGoMod(b)
+}
+
+// parseBaseGoMod parses the contents of the go.mod file at the base revision.
+func (r *Repo) parseBaseGoMod(b []byte) (*modfile.File, error) {
 	mod, err := modfile.Parse(filepath.Join(r.path, "go.mod"), b, nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBaseGoMod, &ParseError{Path: "go.mod", Err: err})
 	}
 
 	return mod, nil
 }
 
-// flagPackageAsChanged flags the package with the given name and all of its
-// dependant as changed, recursively.
-func (r *Repo) flagPackageAsChanged(name string) {
+// flagPackageAsChanged flags the package with the given name as changed by a
+// change of the given kind, and all of its dependants as affected by it,
+// recursively.
+func (r *Repo) flagPackageAsChanged(name string, kind ChangeKind) {
+	if pkg, exists := r.Packages[name]; exists {
+		pkg.direct = true
+	}
+	r.flagPackageAsAffected(name, kind)
+}
+
+// flagPackageAsAffected flags the package with the given name as affected by
+// a change of the given kind in itself or its dependencies, and all of its
+// dependants as affected by it, recursively.
+func (r *Repo) flagPackageAsAffected(name string, kind ChangeKind) {
 	pkg, exists := r.Packages[name]
 	if !exists {
 		return
 	}
 
-	if pkg.Changed {
+	if pkg.ChangeKind >= kind {
 		// assume change was already acked and save
 		// some computation
 		return
 	}
 
+	pkg.Changed = true
+	pkg.ChangeKind = kind
 	for _, d := range pkg.Dependants {
-		r.flagPackageAsChanged(d.Name)
+		r.flagPackageAsAffected(d.Name, kind.propagated())
 	}
-	pkg.Changed = true
 }
 
 func (r *Repo) ModuleName() string {
 	return r.Module.Module.Mod.Path
 }
 
+// OwnsPackage returns true if the package with the given name is part of
+// the module, or of any module nested within the repo.
 func (r *Repo) OwnsPackage(pkgName string) bool {
-	return strings.HasPrefix(pkgName, r.ModuleName())
+	if pkgName == r.ModuleName() || strings.HasPrefix(pkgName, r.ModuleName()+"/") {
+		return true
+	}
+	for _, modulePath := range r.modules {
+		if pkgName == modulePath || strings.HasPrefix(pkgName, modulePath+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 func directoryShouldBeIgnored(path string) bool {
@@ -1,6 +1,13 @@
 package patrol_test
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
 
 func TestRepo(t *testing.T) {
 	tests := RepoTests{
@@ -60,7 +67,132 @@ func TestRepo(t *testing.T) {
 				"should flag a sub package as changed",
 			AllFiles: true,
 		},
+		RepoTest{
+			TestdataFolder: "semanticdiff",
+			Name:           "change in comments and formatting only",
+			Description: "A change to a go file that only touches comments\n" +
+				"or formatting should not flag a package as changed,\n" +
+				"unless a directive changed",
+			AllFiles:     false,
+			SemanticDiff: true,
+		},
+		RepoTest{
+			TestdataFolder: "apisurface",
+			Name:           "change in implementation only",
+			Description: "A change to a package that doesn't change its\n" +
+				"exported API should only require its dependants to be rebuilt",
+			AllFiles:   false,
+			APISurface: true,
+		},
+		RepoTest{
+			TestdataFolder: "symbols",
+			Name:           "change in declarations used by some dependants",
+			Description: "A change to a declaration should only flag\n" +
+				"dependants referencing it, directly or indirectly",
+			AllFiles:    false,
+			SymbolLevel: true,
+		},
+		RepoTest{
+			TestdataFolder: "modcache",
+			Name:           "change in some packages of a go modules dependency",
+			Description: "A change to a go modules dependency found in the\n" +
+				"module cache should only flag packages depending on the\n" +
+				"dependency packages that changed",
+			AllFiles: false,
+			ModCache: true,
+		},
+		RepoTest{
+			TestdataFolder: "indirect",
+			Name:           "change in an indirect go modules dependency",
+			Description: "A change to an indirect go modules dependency\n" +
+				"should flag packages depending on modules requiring it,\n" +
+				"as found in the module cache",
+			AllFiles: false,
+			ModCache: true,
+		},
+		RepoTest{
+			TestdataFolder: "modgraph",
+			Name:           "change in a transitive go modules dependency",
+			Description: "A change to a transitive go modules dependency\n" +
+				"should flag packages depending on modules requiring it,\n" +
+				"as found in go mod graph output",
+			AllFiles: false,
+			ModGraph: true,
+		},
+		RepoTest{
+			TestdataFolder: "invalidgomod",
+			Name:           "invalid go.mod at base revision",
+			Description: "An invalid go.mod at the base revision should\n" +
+				"flag all packages as changed if asked to",
+			AllFiles:      false,
+			OnMissingBase: patrol.MissingBaseAll,
+		},
+		RepoTest{
+			TestdataFolder: "multimodule",
+			Name:           "change in a repo with nested modules",
+			Description: "A change to a package should flag depending\n" +
+				"packages of nested modules as changed, named after\n" +
+				"the module they belong to",
+			AllFiles: false,
+		},
+		RepoTest{
+			TestdataFolder: "options",
+			Name:           "change in files excluded by options",
+			Description: "Without options, changes to tests and to files\n" +
+				"for other platforms should flag their packages",
+			AllFiles: false,
+		},
+		RepoTest{
+			TestdataFolder: "cgo",
+			Name:           "change in cgo and assembly sources",
+			Description: "A change to a C or assembly file of a package, or to\n" +
+				"a file its #cgo directives refer to (directly or through\n" +
+				"pkg-config), should flag the package as changed",
+			AllFiles: false,
+		},
 	}
 
 	tests.Run(t)
 }
+
+func TestPackageDirs(t *testing.T) {
+	repo, err := patrol.NewRepo("testdata/multimodule/commits/1")
+	require.NoError(t, err)
+
+	dirs := map[string]string{}
+	for name, pkg := range repo.Packages {
+		if pkg.PartOfModule {
+			dirs[name] = pkg.Dir
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"github.com/utilitywarehouse/multimodule":         ".",
+		"github.com/utilitywarehouse/multimodule/pkg/foo": "pkg/foo",
+		"example.com/tools/cmd/gen":                       "tools/cmd/gen",
+	}, dirs)
+}
+
+func TestNestedModulePackageNames(t *testing.T) {
+	tmp, commits := newTestRepo(t,
+		"testdata/multimodule/commits/1",
+		"testdata/multimodule/commits/2",
+	)
+
+	repo, err := patrol.NewRepo(tmp)
+	require.NoError(t, err)
+
+	// packages of nested modules are named after their module, not after the
+	// directory they're in within the root module
+	assert.True(t, repo.OwnsPackage("example.com/tools/cmd/gen"))
+	assert.Contains(t, repo.Packages, "example.com/tools/cmd/gen")
+	assert.NotContains(t, repo.Packages, "github.com/utilitywarehouse/multimodule/tools/cmd/gen")
+
+	changes, err := repo.ChangesFrom(commits[0], false)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"github.com/utilitywarehouse/multimodule",
+		"github.com/utilitywarehouse/multimodule/pkg/foo",
+		"example.com/tools/cmd/gen",
+	}, changes)
+}
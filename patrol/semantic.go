@@ -0,0 +1,195 @@
+package patrol
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	commentGroupType = reflect.TypeOf(&ast.CommentGroup{})
+	objectType       = reflect.TypeOf(&ast.Object{})
+	scopeType        = reflect.TypeOf(&ast.Scope{})
+	fileType         = reflect.TypeOf(ast.File{})
+	callExprType     = reflect.TypeOf(ast.CallExpr{})
+)
+
+// semanticallyEqual reports whether the two given Go source files are
+// equivalent once comments and formatting are ignored. Directives (such as
+// //go:embed or //go:build) are considered significant, so a change to any
+// of them, or moving one to another declaration, makes the files different. Files that can't be parsed are never
+// considered equal.
+func semanticallyEqual(a, b []byte) bool {
+	fileA, err := parser.ParseFile(token.NewFileSet(), "", a, parser.ParseComments)
+	if err != nil {
+		return false
+	}
+
+	fileB, err := parser.ParseFile(token.NewFileSet(), "", b, parser.ParseComments)
+	if err != nil {
+		return false
+	}
+
+	if !reflect.DeepEqual(directives(fileA), directives(fileB)) {
+		return false
+	}
+
+	return astEqual(reflect.ValueOf(fileA), reflect.ValueOf(fileB))
+}
+
+// directives returns, in order, all the comments in file that affect how it
+// is built: //go: directives, +build constraints, cgo exports and the cgo
+// preamble. Each directive is prefixed by the declaration it applies to (see
+// directiveTarget), so moving one to another declaration changes them.
+func directives(file *ast.File) []string {
+	var result []string
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//go:") ||
+				strings.HasPrefix(c.Text, "// +build") ||
+				strings.HasPrefix(c.Text, "//export ") ||
+				strings.HasPrefix(c.Text, "//line ") {
+				result = append(result, directiveTarget(file, c.End())+": "+strings.TrimSpace(c.Text))
+			}
+		}
+	}
+
+	// the comment right above import "C" is C code compiled with the package
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			if imp.Path.Value != `"C"` {
+				continue
+			}
+			if imp.Doc != nil {
+				result = append(result, imp.Doc.Text())
+			} else if gen.Doc != nil {
+				result = append(result, gen.Doc.Text())
+			}
+		}
+	}
+
+	return result
+}
+
+// directiveTarget describes the declaration a directive ending at pos
+// applies to: the package for directives above the package clause, otherwise
+// the first declaration (or spec, within a group) following it, or the
+// function it's in.
+func directiveTarget(file *ast.File, pos token.Pos) string {
+	if pos < file.Package {
+		return "package"
+	}
+
+	for _, decl := range file.Decls {
+		if decl.Pos() >= pos {
+			return declarationName(decl)
+		}
+		if decl.End() <= pos {
+			continue
+		}
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gen.Specs {
+				if spec.Pos() >= pos {
+					return declarationName(spec)
+				}
+			}
+		}
+		return "in " + declarationName(decl)
+	}
+
+	return "end of file"
+}
+
+// declarationName describes a declaration, or a spec within one, by the
+// names it declares.
+func declarationName(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		if node.Recv != nil && len(node.Recv.List) > 0 {
+			return "func " + types.ExprString(node.Recv.List[0].Type) + "." + node.Name.Name
+		}
+		return "func " + node.Name.Name
+	case *ast.GenDecl:
+		var names []string
+		for _, spec := range node.Specs {
+			names = append(names, declarationName(spec))
+		}
+		return node.Tok.String() + " (" + strings.Join(names, "; ") + ")"
+	case *ast.TypeSpec:
+		return node.Name.Name
+	case *ast.ValueSpec:
+		var names []string
+		for _, name := range node.Names {
+			names = append(names, name.Name)
+		}
+		return strings.Join(names, ", ")
+	case *ast.ImportSpec:
+		return node.Path.Value
+	default:
+		return ""
+	}
+}
+
+// astEqual compares two AST nodes ignoring positions, comments and the
+// objects resolved by the parser.
+func astEqual(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Type() {
+	case posType, commentGroupType, objectType, scopeType:
+		return true
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return astEqual(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !astEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if a.Type() == fileType {
+			// comments, imports and unresolved identifiers are either ignored
+			// or already part of the declarations
+			fileA, fileB := a.Interface().(ast.File), b.Interface().(ast.File)
+			return fileA.Name.Name == fileB.Name.Name &&
+				astEqual(reflect.ValueOf(fileA.Decls), reflect.ValueOf(fileB.Decls))
+		}
+		if a.Type() == callExprType {
+			// the position of ... is the only one that matters: f(x) and
+			// f(x...) only differ by it
+			callA, callB := a.Interface().(ast.CallExpr), b.Interface().(ast.CallExpr)
+			if callA.Ellipsis.IsValid() != callB.Ellipsis.IsValid() {
+				return false
+			}
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !astEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
@@ -0,0 +1,291 @@
+package patrol
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemanticallyEqual(t *testing.T) {
+	const base = `package foo
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+// Foo returns foo.
+func Foo() string {
+	return "foo"
+}
+`
+
+	tests := []struct {
+		name     string
+		changed  string
+		expected bool
+	}{
+		{
+			name:     "identical",
+			changed:  base,
+			expected: true,
+		},
+		{
+			name: "comments",
+			changed: `package foo
+
+import "embed"
+
+// static files
+//
+//go:embed static
+var static embed.FS
+
+// Foo returns "foo", always.
+func Foo() string {
+	// nothing else
+	return "foo"
+}
+`,
+			expected: true,
+		},
+		{
+			name: "formatting",
+			changed: `package foo
+import "embed"
+//go:embed static
+var static embed.FS
+func Foo() string { return "foo" }
+`,
+			expected: true,
+		},
+		{
+			name: "code",
+			changed: `package foo
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+// Foo returns foo.
+func Foo() string {
+	return "bar"
+}
+`,
+		},
+		{
+			name: "package name",
+			changed: `package bar
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+// Foo returns foo.
+func Foo() string {
+	return "foo"
+}
+`,
+		},
+		{
+			name: "directive",
+			changed: `package foo
+
+import "embed"
+
+//go:embed static templates
+var static embed.FS
+
+// Foo returns foo.
+func Foo() string {
+	return "foo"
+}
+`,
+		},
+		{
+			name: "build constraint added",
+			changed: `//go:build linux
+
+package foo
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+// Foo returns foo.
+func Foo() string {
+	return "foo"
+}
+`,
+		},
+		{
+			name: "cgo export added",
+			changed: `package foo
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+// Foo returns foo.
+//
+//export Foo
+func Foo() string {
+	return "foo"
+}
+`,
+		},
+		{
+			name:    "invalid",
+			changed: base + "}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, semanticallyEqual([]byte(base), []byte(test.changed)))
+			assert.Equal(t, test.expected, semanticallyEqual([]byte(test.changed), []byte(base)))
+		})
+	}
+}
+
+func TestSemanticallyEqualCgoPreamble(t *testing.T) {
+	const preamble = `package foo
+
+// #include <stdio.h>
+// #define SIZE %s
+import "C"
+`
+
+	assert.True(t, semanticallyEqual([]byte(preamble), []byte(preamble)))
+	assert.False(t, semanticallyEqual(
+		[]byte(`package foo
+
+// #define SIZE 1
+import "C"
+`),
+		[]byte(`package foo
+
+// #define SIZE 2
+import "C"
+`),
+	))
+	assert.False(t, semanticallyEqual(
+		[]byte(`package foo
+
+// #define SIZE 1
+import (
+	"C"
+)
+`),
+		[]byte(`package foo
+
+import (
+	// #define SIZE 2
+	"C"
+)
+`),
+	))
+}
+
+func TestSemanticallyEqualMovedDirectives(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{
+			name: "between functions",
+			a:    "package foo\n\n//go:noinline\nfunc A() {}\n\nfunc B() {}\n",
+			b:    "package foo\n\nfunc A() {}\n\n//go:noinline\nfunc B() {}\n",
+		},
+		{
+			name: "between methods",
+			a:    "package foo\n\n//go:noinline\nfunc (T) A() {}\n\nfunc (*T) A() {}\n",
+			b:    "package foo\n\nfunc (T) A() {}\n\n//go:noinline\nfunc (*T) A() {}\n",
+		},
+		{
+			name: "within a group",
+			a:    "package foo\n\nimport \"embed\"\n\nvar (\n\t//go:embed a\n\ta embed.FS\n\tb embed.FS\n)\n",
+			b:    "package foo\n\nimport \"embed\"\n\nvar (\n\ta embed.FS\n\t//go:embed a\n\tb embed.FS\n)\n",
+		},
+		{
+			name: "into a function",
+			a:    "package foo\n\n//line foo.y:1\nfunc A() {\n\tprintln()\n}\n",
+			b:    "package foo\n\nfunc A() {\n\t//line foo.y:1\n\tprintln()\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.False(t, semanticallyEqual([]byte(test.a), []byte(test.b)))
+		})
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", `//go:build linux
+// +build linux
+
+package foo
+
+// #include <stdlib.h>
+import "C"
+
+//go:generate stringer -type=Kind
+
+// Kind is not a directive.
+type Kind int
+
+//export Free
+func Free() {}
+
+//line foo.y:10
+var x int
+`, parser.ParseComments)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"package: //go:build linux",
+		"package: // +build linux",
+		"type (Kind): //go:generate stringer -type=Kind",
+		"func Free: //export Free",
+		"var (x): //line foo.y:10",
+		"#include <stdlib.h>\n",
+	}, directives(file))
+}
+
+func TestASTEqual(t *testing.T) {
+	parse := func(src string) ast.Expr {
+		expr, err := parser.ParseExpr(src)
+		require.NoError(t, err)
+		return expr
+	}
+
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: "a + b", b: "a  +  b", expected: true},
+		{a: "a + b", b: "(a + b)"},
+		{a: "a + b", b: "a - b"},
+		{a: "f(x)", b: "f(x...)"},
+		{a: "[]int{1, 2}", b: "[]int{1, 2,\n}", expected: true},
+		{a: "[]int{1, 2}", b: "[]int{2, 1}"},
+		{a: "x.(T)", b: "x.(type)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" vs "+test.b, func(t *testing.T) {
+			a, b := parse(test.a), parse(test.b)
+			assert.Equal(t, test.expected, astEqual(reflect.ValueOf(a), reflect.ValueOf(b)))
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package patrol
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Stats describes how packages changed over a period of time, to find
+// hotspots: packages changed often and affecting many others.
+type Stats struct {
+	// Commits is the number of commits the stats were computed from.
+	Commits int
+
+	// Packages lists the packages within the repository that changed,
+	// sorted by the number of commits changing them and then by their fan-out.
+	Packages []PackageStats
+
+	// Dependencies lists the modules required in go.mod that changed, sorted
+	// by the number of packages within the repository they affected.
+	Dependencies []DependencyStats
+}
+
+// PackageStats describes how often a package changed.
+type PackageStats struct {
+	Name string
+
+	// Changed is the number of commits that changed the package itself.
+	Changed int
+
+	// Affected is the number of commits that only changed dependencies of the
+	// package.
+	Affected int
+
+	// FanOut is the average number of other packages within the repository
+	// affected by the commits that changed the package itself.
+	FanOut float64
+}
+
+// DependencyStats describes how often a module required in go.mod changed.
+type DependencyStats struct {
+	Module string
+
+	// Changed is the number of commits that changed the module requirement.
+	Changed int
+
+	// Rebuilds is the number of packages within the repository affected by
+	// those commits, added up.
+	Rebuilds int
+
+	// FanOut is the average number of packages within the repository
+	// affected by each of those commits.
+	FanOut float64
+}
+
+// Stats walks the first parent history of HEAD back to since and returns how
+// often each package changed and how many packages it affected. allChanges is
+// the same as in ChangesFrom, and r's options (e.g. SemanticDiff) apply,
+// but r's packages aren't modified.
+func (r *Repo) Stats(since time.Time, allChanges bool) (*Stats, error) {
+	g, err := r.openGoGit()
+	if err != nil {
+		return nil, err
+	}
+	repo := g.repo
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := commitsSince(repo, head.Hash(), since)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := map[string]*PackageStats{}
+	dependencies := map[string]*DependencyStats{}
+	fanOut := map[string]int{}
+
+	err = r.walkCommits(commits, allChanges, func(_ int, _ *object.Commit, walker *Repo, changes []string) error {
+		for _, name := range changes {
+			stats, ok := packages[name]
+			if !ok {
+				stats = &PackageStats{Name: name}
+				packages[name] = stats
+			}
+
+			pkg := walker.Packages[name]
+			if pkg.direct {
+				stats.Changed++
+				fanOut[name] += walker.affectedBy(pkg)
+			} else {
+				stats.Affected++
+			}
+		}
+
+		for module, flagged := range walker.changedModules {
+			stats, ok := dependencies[module]
+			if !ok {
+				stats = &DependencyStats{Module: module}
+				dependencies[module] = stats
+			}
+
+			var pkgs []*Package
+			for _, name := range flagged {
+				if pkg, exists := walker.Packages[name]; exists {
+					pkgs = append(pkgs, pkg)
+				}
+			}
+
+			stats.Changed++
+			stats.Rebuilds += walker.affectedBy(pkgs...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Stats{Commits: len(commits)}
+
+	for name, stats := range packages {
+		if stats.Changed > 0 {
+			stats.FanOut = float64(fanOut[name]) / float64(stats.Changed)
+		}
+		result.Packages = append(result.Packages, *stats)
+	}
+	sort.Slice(result.Packages, func(i, j int) bool {
+		a, b := result.Packages[i], result.Packages[j]
+		if a.Changed != b.Changed {
+			return a.Changed > b.Changed
+		}
+		if a.FanOut != b.FanOut {
+			return a.FanOut > b.FanOut
+		}
+		if a.Affected != b.Affected {
+			return a.Affected > b.Affected
+		}
+		return a.Name < b.Name
+	})
+
+	for _, stats := range dependencies {
+		stats.FanOut = float64(stats.Rebuilds) / float64(stats.Changed)
+		result.Dependencies = append(result.Dependencies, *stats)
+	}
+	sort.Slice(result.Dependencies, func(i, j int) bool {
+		a, b := result.Dependencies[i], result.Dependencies[j]
+		if a.Rebuilds != b.Rebuilds {
+			return a.Rebuilds > b.Rebuilds
+		}
+		if a.Changed != b.Changed {
+			return a.Changed > b.Changed
+		}
+		return a.Module < b.Module
+	})
+
+	return result, nil
+}
+
+// affectedBy returns the number of packages within the repository, other
+// than the given ones, that were flagged as changed through the given
+// packages. Packages changed themselves aren't counted (they'd have been
+// flagged anyway), but their dependants are.
+func (r *Repo) affectedBy(pkgs ...*Package) int {
+	visited := map[string]bool{}
+	for _, pkg := range pkgs {
+		visited[pkg.Name] = true
+	}
+
+	count := 0
+	queue := append([]*Package{}, pkgs...)
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		for _, d := range pkg.Dependants {
+			if visited[d.Name] || !d.Changed {
+				continue
+			}
+			visited[d.Name] = true
+			if d.PartOfModule && !d.direct {
+				count++
+			}
+			queue = append(queue, d)
+		}
+	}
+
+	return count
+}
+
+// commitsSince returns the first parent history of the given commit back to
+// since, oldest first. Commits whose parent can't be found (e.g. in shallow
+// clones) are left out, as their changes can't be detected.
+func commitsSince(repo *git.Repository, hash plumbing.Hash, since time.Time) ([]*object.Commit, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	for !commit.Committer.When.Before(since) {
+		if commit.NumParents() == 0 {
+			commits = append(commits, commit)
+			break
+		}
+
+		parent, err := commit.Parent(0)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, commit)
+		commit = parent
+	}
+
+	reverseCommits(commits)
+	return commits, nil
+}
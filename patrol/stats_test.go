@@ -0,0 +1,90 @@
+package patrol_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("packages", func(t *testing.T) {
+		tmp, _ := newTestRepo(t,
+			"testdata/multimodule/commits/1",
+			"testdata/multimodule/commits/2",
+			"testdata/multimodule/commits/3",
+			"testdata/multimodule/commits/4",
+		)
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		stats, err := repo.Stats(time.Time{}, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, &patrol.Stats{
+			Commits: 4,
+			Packages: []patrol.PackageStats{
+				{Name: "github.com/utilitywarehouse/multimodule/pkg/foo", Changed: 2, FanOut: 1},
+				{Name: "example.com/tools/cmd/gen", Changed: 2, Affected: 1},
+				{Name: "github.com/utilitywarehouse/multimodule", Changed: 2, Affected: 1},
+			},
+		}, stats)
+	})
+
+	t.Run("related packages changed together", func(t *testing.T) {
+		tmp, _ := newTestRepo(t,
+			"testdata/internalchange/commits/1",
+			"testdata/internalchange/commits/3",
+			"testdata/internalchange/commits/4",
+		)
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		stats, err := repo.Stats(time.Time{}, false)
+		require.NoError(t, err)
+
+		// the last commit changes both bar and foo, which imports bar: foo
+		// isn't affected by bar, only cat is
+		assert.Equal(t, []patrol.PackageStats{
+			{Name: "github.com/utilitywarehouse/internalchange/internal/bar", Changed: 3, FanOut: 1},
+			{Name: "github.com/utilitywarehouse/internalchange/pkg/foo", Changed: 2, Affected: 1, FanOut: 0.5},
+			{Name: "github.com/utilitywarehouse/internalchange/pkg/cat", Changed: 1, Affected: 2},
+		}, stats.Packages)
+	})
+
+	t.Run("dependencies", func(t *testing.T) {
+		tmp, _ := newTestRepo(t,
+			"testdata/modules/commits/1",
+			"testdata/modules/commits/2",
+		)
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		stats, err := repo.Stats(time.Time{}, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, []patrol.DependencyStats{
+			{Module: "github.com/sirupsen/logrus", Changed: 1, Rebuilds: 1, FanOut: 1},
+		}, stats.Dependencies)
+		assert.Equal(t, []patrol.PackageStats{
+			{Name: "github.com/utilitywarehouse/modules", Changed: 1, Affected: 1},
+		}, stats.Packages)
+	})
+
+	t.Run("since", func(t *testing.T) {
+		tmp, _ := newTestRepo(t, "testdata/modules/commits/1")
+
+		repo, err := patrol.NewRepo(tmp)
+		require.NoError(t, err)
+
+		stats, err := repo.Stats(time.Now().Add(time.Hour), false)
+		require.NoError(t, err)
+		assert.Equal(t, &patrol.Stats{}, stats)
+	})
+}
@@ -0,0 +1,193 @@
+package patrol
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// submodules wraps a vcs so that changes to submodules are detected: rather
+// than the commit a submodule points to, the files that changed between the
+// two commits are reported (recursively), and files within submodules can be
+// read. Submodules that aren't checked out are skipped, as none of their
+// packages can be known either.
+type submodules struct {
+	vcs
+}
+
+func (s submodules) changedFiles(ctx context.Context, then, now string) ([]fileChange, error) {
+	changes, err := s.vcs.changedFiles(ctx, then, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var expanded []fileChange
+	for _, change := range changes {
+		if change.nowLink == "" && change.thenLink == "" {
+			expanded = append(expanded, change)
+			continue
+		}
+
+		dir := change.now
+		if dir == "" {
+			dir = change.then
+		}
+
+		sub, err := s.submodule(dir)
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			continue
+		}
+
+		subChanges, err := sub.changedFiles(ctx, change.thenLink, change.nowLink)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range subChanges {
+			expanded = append(expanded, fileChange{now: joinName(dir, c.now), then: joinName(dir, c.then)})
+		}
+	}
+	return expanded, nil
+}
+
+func (s submodules) readFile(ctx context.Context, commit, name string) ([]byte, error) {
+	contents, err := s.vcs.readFile(ctx, commit, name)
+	if !errors.Is(err, os.ErrNotExist) {
+		return contents, err
+	}
+
+	sub, subCommit, dir, subErr := s.inSubmodule(ctx, commit, path.Dir(name))
+	if subErr != nil {
+		return nil, subErr
+	}
+	if sub == nil {
+		return nil, err
+	}
+	return sub.readFile(ctx, subCommit, path.Join(dir, path.Base(name)))
+}
+
+func (s submodules) readDir(ctx context.Context, commit, dir string) ([]string, error) {
+	names, err := s.vcs.readDir(ctx, commit, dir)
+	if len(names) > 0 {
+		return names, err
+	}
+
+	sub, subCommit, subDir, subErr := s.inSubmodule(ctx, commit, dir)
+	if subErr != nil {
+		return nil, subErr
+	}
+	if sub == nil {
+		return names, err
+	}
+	return sub.readDir(ctx, subCommit, subDir)
+}
+
+func (s submodules) worktreeChanges(ctx context.Context) ([]string, error) {
+	names, err := s.vcs.worktreeChanges(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var expanded []string
+	for _, name := range names {
+		sub, err := s.submodule(name)
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			expanded = append(expanded, name)
+			continue
+		}
+
+		// the submodule might have uncommitted changes, as well as another
+		// commit checked out
+		subNames, err := sub.worktreeChanges(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		head, err := s.resolveRevision(ctx, "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		then, err := s.gitlink(ctx, head, name)
+		if err != nil {
+			return nil, err
+		}
+		now, err := sub.resolveRevision(ctx, "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		if now != then {
+			changes, err := sub.changedFiles(ctx, then, now)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range changes {
+				for _, n := range []string{c.now, c.then} {
+					if n != "" {
+						subNames = append(subNames, n)
+					}
+				}
+			}
+		}
+
+		for _, n := range subNames {
+			expanded = append(expanded, path.Join(name, n))
+		}
+	}
+	return expanded, nil
+}
+
+func (s submodules) submodule(dir string) (vcs, error) {
+	sub, err := s.vcs.submodule(dir)
+	if sub == nil || err != nil {
+		return nil, err
+	}
+	return submodules{sub}, nil
+}
+
+// inSubmodule returns the checked out submodule dir is in at commit, if any,
+// with the commit it points to and dir relative to it.
+func (s submodules) inSubmodule(ctx context.Context, commit, dir string) (vcs, string, string, error) {
+	if dir == "." {
+		return nil, "", "", nil
+	}
+
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		subDir := path.Join(parts[:i+1]...)
+
+		link, err := s.gitlink(ctx, commit, subDir)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if link == "" {
+			continue
+		}
+
+		sub, err := s.submodule(subDir)
+		if sub == nil || err != nil {
+			return nil, "", "", err
+		}
+		rest := "."
+		if i+1 < len(parts) {
+			rest = path.Join(parts[i+1:]...)
+		}
+		return sub, link, rest, nil
+	}
+	return nil, "", "", nil
+}
+
+// joinName joins the name of a file within the submodule at dir to it,
+// unless it's empty.
+func joinName(dir, name string) string {
+	if name == "" {
+		return ""
+	}
+	return path.Join(dir, name)
+}
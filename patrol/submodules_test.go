@@ -0,0 +1,81 @@
+package patrol_test
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestSubmodules(t *testing.T) {
+	const module = "github.com/utilitywarehouse/gitsubmodules"
+
+	for _, backend := range []patrol.VCSBackend{patrol.VCSGoGit, patrol.VCSGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			lib, libCommits := newTestRepo(t,
+				"testdata/gitsubmodules/lib/commits/1",
+				"testdata/gitsubmodules/lib/commits/2",
+			)
+			tmp, commits := newTestRepo(t, "testdata/gitsubmodules/commits/1")
+			sub := filepath.Join(tmp, "libs", "lib")
+
+			// add the submodule, then point it to the next commit
+			runGit(t, tmp, "-c", "protocol.file.allow=always", "submodule", "add", "-q", lib, "libs/lib")
+			for _, libCommit := range libCommits {
+				runGit(t, sub, "checkout", "-q", libCommit)
+				runGit(t, tmp, "add", "libs/lib")
+				runGit(t, tmp, "commit", "-q", "-m", "libs/lib at "+libCommit)
+				commits = append(commits, runGit(t, tmp, "rev-parse", "HEAD"))
+			}
+
+			repo, err := patrol.NewRepo(tmp, patrol.VCS(backend))
+			require.NoError(t, err)
+
+			changes, err := repo.Changes(context.Background(), commits[1])
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{module + "/cmd/app", module + "/libs/lib/bar"}, changes)
+
+			// packages are read from the submodule commit too
+			require.NoError(t, repo.LoadRevision(commits[1]))
+
+			changes, err = repo.Changes(context.Background(), commits[0])
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{
+				module + "/cmd/app",
+				module + "/pkg/baz",
+				module + "/libs/lib/bar",
+				module + "/libs/lib/foo",
+			}, changes)
+
+			// the submodule checked out at another commit isn't committed
+			runGit(t, sub, "checkout", "-q", libCommits[0])
+
+			repo, err = patrol.NewRepo(tmp, patrol.VCS(backend), patrol.Worktree())
+			require.NoError(t, err)
+
+			changes, err = repo.Changes(context.Background(), commits[2])
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{module + "/cmd/app", module + "/libs/lib/bar"}, changes)
+		})
+	}
+}
+
+// runGit runs git in dir and returns its output, trimmed.
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{
+		"-c", "user.name=patrol test",
+		"-c", "user.email=patrol@test.me",
+	}, args...)...)
+	cmd.Dir = dir
+
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,483 @@
+package patrol
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// initSymbol is the key used for init functions and the initializers of blank
+// package level variables (var _ = f()), which run at import time too.
+// Packages importing a package whose initialisation changed are affected even
+// if they don't reference any of its identifiers.
+const initSymbol = "init"
+
+// Declarations of test files are kept apart from the package's own ones, by
+// prefixing their keys: test files in the package share its scope (but aren't
+// visible to importers), external test packages have a scope of their own.
+const (
+	testScope  = "test:"
+	xtestScope = "xtest:"
+)
+
+// declaration is a top level declaration within a package. Declarations are
+// keyed by their name, or Type.Method for methods, prefixed by the scope of
+// test files.
+type declaration struct {
+	node ast.Node
+	file *ast.File
+}
+
+// symbolPackage is a package parsed for symbol level analysis.
+type symbolPackage struct {
+	name  string
+	files []*ast.File
+	decls map[string][]declaration
+}
+
+// flagChangedSymbols flags as changed the packages in goPackages (a map of
+// package name to directory) whose top level declarations differ between the
+// two commits. Changes are then propagated only to dependants referencing any
+// of the changed declarations, directly or through their own declarations.
+func (r *Repo) flagChangedSymbols(ctx context.Context, v vcs, now, then string, goPackages map[string]string) error {
+	parsed := map[string]*symbolPackage{}
+	load := func(name string) (*symbolPackage, error) {
+		if pkg, ok := parsed[name]; ok {
+			return pkg, nil
+		}
+		pkg, err := parseSymbolPackage(ctx, v, now, r.packageDir(name))
+		if err != nil {
+			return nil, err
+		}
+		parsed[name] = pkg
+		return pkg, nil
+	}
+
+	// affected keeps track of the declarations known to be affected for each
+	// package, queue of the packages with new affected declarations
+	affected := map[string]map[string]bool{}
+	var queue []string
+
+	for pkgName, dir := range goPackages {
+		nowPkg, err := load(pkgName)
+		if err != nil {
+			return err
+		}
+		thenPkg, err := parseSymbolPackage(ctx, v, then, dir)
+		if err != nil {
+			return err
+		}
+
+		if nowPkg == nil || thenPkg == nil {
+			// the package was added, removed or can't be parsed, there's no
+			// telling what changed
+			r.flagPackageAsChanged(pkgName, ChangedAPI)
+			continue
+		}
+
+		changed := nowPkg.closure(changedDeclarations(nowPkg, thenPkg))
+		if len(changed) == 0 {
+			continue
+		}
+		affected[pkgName] = changed
+		queue = append(queue, pkgName)
+		if pkg, exists := r.Packages[pkgName]; exists {
+			pkg.direct = true
+		}
+	}
+
+	for len(queue) > 0 {
+		pkgName := queue[0]
+		queue = queue[1:]
+
+		pkg, exists := r.Packages[pkgName]
+		if !exists {
+			continue
+		}
+		if pkg.ChangeKind < ChangedAPI {
+			pkg.Changed = true
+			pkg.ChangeKind = ChangedAPI
+		}
+
+		dependency, err := load(pkgName)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range pkg.Dependants {
+			if d.ChangeKind == ChangedAPI && affected[d.Name] == nil {
+				// already flagged as a whole
+				continue
+			}
+
+			dependant, err := load(d.Name)
+			if err != nil {
+				return err
+			}
+			if dependant == nil {
+				r.flagPackageAsAffected(d.Name, ChangedAPI)
+				continue
+			}
+
+			uses := dependant.uses(pkgName, dependency, affected[pkgName])
+			if len(uses) == 0 {
+				continue
+			}
+
+			if affected[d.Name] == nil {
+				affected[d.Name] = map[string]bool{}
+			}
+			grown := false
+			for key := range dependant.closure(uses) {
+				if !affected[d.Name][key] {
+					affected[d.Name][key] = true
+					grown = true
+				}
+			}
+			if grown {
+				queue = append(queue, d.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// packageDir returns the directory, relative to the repository root, of the
+// package with the given name.
+func (r *Repo) packageDir(name string) string {
+	if pkg, ok := r.Packages[name]; ok && pkg.Dir != "" {
+		return pkg.Dir
+	}
+	return "vendor/" + name
+}
+
+// parseSymbolPackage parses all .go files (tests included) found in dir at
+// commit. It returns nil if there are no such files or if any of them can't
+// be parsed.
+func parseSymbolPackage(ctx context.Context, v vcs, commit, dir string) (*symbolPackage, error) {
+	names, err := v.readDir(ctx, commit, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &symbolPackage{decls: map[string][]declaration{}}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+
+		contents, err := v.readFile(ctx, commit, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := parser.ParseFile(fset, path.Join(dir, name), contents, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, nil
+		}
+
+		pkg.addFile(name, file)
+	}
+
+	if len(pkg.files) == 0 {
+		return nil, nil
+	}
+
+	return pkg, nil
+}
+
+// addFile adds the declarations of the file with the given name to pkg,
+// within the scope of test files if it's one.
+func (pkg *symbolPackage) addFile(name string, file *ast.File) {
+	scope := ""
+	switch {
+	case strings.HasSuffix(file.Name.Name, "_test"):
+		scope = xtestScope
+	case strings.HasSuffix(name, "_test.go"):
+		scope = testScope
+	}
+
+	if !strings.HasSuffix(file.Name.Name, "_test") {
+		pkg.name = file.Name.Name
+	}
+	pkg.files = append(pkg.files, file)
+	for key, node := range topLevelDeclarations(file) {
+		pkg.decls[scope+key] = append(pkg.decls[scope+key], node...)
+	}
+}
+
+// topLevelDeclarations returns the declarations in file keyed by name.
+// Constants declared together are kept together, as their values might
+// depend on each other through iota. Blank variables are keyed as initSymbol.
+func topLevelDeclarations(file *ast.File) map[string][]declaration {
+	decls := map[string][]declaration{}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			key := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				key = receiverTypeName(decl.Recv.List[0].Type) + "." + key
+			}
+			decls[key] = append(decls[key], declaration{node: decl, file: file})
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					decls[spec.Name.Name] = append(decls[spec.Name.Name], declaration{node: spec, file: file})
+				case *ast.ValueSpec:
+					var node ast.Node = spec
+					if decl.Tok == token.CONST {
+						node = decl
+					}
+					for _, name := range spec.Names {
+						key := name.Name
+						if key == "_" && decl.Tok == token.VAR {
+							key = initSymbol
+						}
+						decls[key] = append(decls[key], declaration{node: node, file: file})
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// changedDeclarations returns the keys of the declarations that were added,
+// removed or changed between then and now. Comments and formatting are
+// ignored, but if any directive changed all declarations are considered
+// changed.
+func changedDeclarations(now, then *symbolPackage) map[string]bool {
+	changed := map[string]bool{}
+
+	if !reflect.DeepEqual(packageDirectives(now), packageDirectives(then)) {
+		for key := range now.decls {
+			changed[key] = true
+		}
+		return changed
+	}
+
+	for key, nowDecls := range now.decls {
+		thenDecls, exists := then.decls[key]
+		if !exists || len(thenDecls) != len(nowDecls) {
+			changed[key] = true
+			continue
+		}
+		for i := range nowDecls {
+			if !astEqual(reflect.ValueOf(nowDecls[i].node), reflect.ValueOf(thenDecls[i].node)) ||
+				!reflect.DeepEqual(nowDecls[i].imports(), thenDecls[i].imports()) {
+				changed[key] = true
+				break
+			}
+		}
+	}
+
+	for key := range then.decls {
+		if _, exists := now.decls[key]; !exists {
+			changed[key] = true
+		}
+	}
+
+	return changed
+}
+
+// packageDirectives returns the directives found in all the package files.
+func packageDirectives(pkg *symbolPackage) []string {
+	var result []string
+	for _, file := range pkg.files {
+		result = append(result, directives(file)...)
+	}
+	return result
+}
+
+// imports returns the paths of the imports referenced by the declaration,
+// keyed by the name they're referenced with. Two identical declarations
+// might refer to different packages if the imports of the file changed.
+func (d declaration) imports() map[string]string {
+	names := importNames(d.file)
+	result := map[string]string{}
+	ast.Inspect(d.node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				if p, ok := names[x.Name]; ok {
+					result[x.Name] = p
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// importNames returns the import paths of file keyed by the name they can be
+// referenced with. Packages imported without an explicit name are assumed to
+// be named after the last element of their path.
+func importNames(file *ast.File) map[string]string {
+	names := map[string]string{}
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if imp.Name != nil {
+			names[imp.Name.Name] = p
+		} else {
+			names[path.Base(p)] = p
+		}
+	}
+	return names
+}
+
+// closure returns seeds together with all the declarations in pkg that
+// reference any of them, directly or indirectly. Types are considered
+// affected if any of their methods are.
+func (pkg *symbolPackage) closure(seeds map[string]bool) map[string]bool {
+	result := map[string]bool{}
+	for key := range seeds {
+		result[key] = true
+	}
+
+	for {
+		grown := false
+		for key, decls := range pkg.decls {
+			if result[key] {
+				continue
+			}
+			scope := declarationScope(key)
+			affected := func(name string) bool {
+				// test files in the package see its declarations too
+				return result[scope+name] || scope == testScope && result[name]
+			}
+			for _, decl := range decls {
+				if references(decl.node, affected) {
+					result[key] = true
+					grown = true
+					break
+				}
+			}
+		}
+
+		for key := range result {
+			if recv, _, isMethod := strings.Cut(key, "."); isMethod && !result[recv] {
+				if _, exists := pkg.decls[recv]; exists {
+					result[recv] = true
+					grown = true
+				}
+			}
+		}
+
+		if !grown {
+			return result
+		}
+	}
+}
+
+// declarationScope returns the scope prefix of the given declaration key.
+func declarationScope(key string) string {
+	switch {
+	case strings.HasPrefix(key, testScope):
+		return testScope
+	case strings.HasPrefix(key, xtestScope):
+		return xtestScope
+	default:
+		return ""
+	}
+}
+
+// references returns true if node uses any of the identifiers selected by
+// identifiers. Selectors and the names of fields and parameters are ignored,
+// as they refer to fields, methods or other packages, or declare new names.
+func references(node ast.Node, identifiers func(name string) bool) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && identifiers(id.Name) {
+					found = true
+				}
+				return !found
+			})
+			return false
+		case *ast.Field:
+			found = references(n.Type, identifiers)
+			return false
+		case *ast.Ident:
+			found = identifiers(n.Name)
+		}
+		return !found
+	})
+	return found
+}
+
+// uses returns the declarations in pkg that reference any of the given
+// symbols of the package imported as importPath (dependency).
+func (pkg *symbolPackage) uses(importPath string, dependency *symbolPackage, symbols map[string]bool) map[string]bool {
+	result := map[string]bool{}
+	if symbols[initSymbol] {
+		result[initSymbol] = true
+	}
+
+	for _, file := range pkg.files {
+		var names []string
+		for _, imp := range file.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err != nil || p != importPath {
+				continue
+			}
+			name := dependency.name
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			names = append(names, name)
+		}
+
+		for _, name := range names {
+			if name == "." {
+				// we can't tell which identifiers come from a dot import
+				for key, decls := range pkg.decls {
+					for _, decl := range decls {
+						if decl.file == file {
+							result[key] = true
+						}
+					}
+				}
+				continue
+			}
+
+			for key, decls := range pkg.decls {
+				for _, decl := range decls {
+					if decl.file == file && usesQualified(decl.node, name, symbols) {
+						result[key] = true
+					}
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// usesQualified returns true if node references any of the given symbols
+// through the package name qualifier.
+func usesQualified(node ast.Node, qualifier string, symbols map[string]bool) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == qualifier && symbols[sel.Sel.Name] {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
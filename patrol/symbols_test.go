@@ -0,0 +1,344 @@
+package patrol
+
+import (
+	"go/parser"
+	"go/token"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSymbolPackage parses the given sources, keyed by file name, the same way
+// parseSymbolPackage does.
+func newSymbolPackage(t *testing.T, files map[string]string) *symbolPackage {
+	t.Helper()
+
+	pkg := &symbolPackage{decls: map[string][]declaration{}}
+	fset := token.NewFileSet()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, name, files[name], parser.ParseComments|parser.SkipObjectResolution)
+		require.NoError(t, err)
+		pkg.addFile(name, file)
+	}
+	return pkg
+}
+
+// keys returns the sorted keys of a set.
+func keys(set map[string]bool) []string {
+	var result []string
+	for key := range set {
+		result = append(result, key)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestSymbolPackageDeclarations(t *testing.T) {
+	pkg := newSymbolPackage(t, map[string]string{
+		"foo.go": `package foo
+const (
+	A = iota
+	B
+)
+var C, D = 1, 2
+var _ = register()
+type T[E any] struct{}
+func (t *T[E]) Method() {}
+func init() {}
+func register() int { return 0 }
+`,
+		"foo_test.go": `package foo
+func helper() {}
+`,
+		"export_test.go": `package foo_test
+func helper() {}
+`,
+	})
+
+	assert.Equal(t, "foo", pkg.name)
+	assert.Len(t, pkg.files, 3)
+
+	var keys []string
+	for key := range pkg.decls {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{
+		"A", "B", "C", "D", "T", "T.Method", "init", "register",
+		"test:helper", "xtest:helper",
+	}, keys)
+
+	// blank variables are initialised like init functions are run
+	assert.Len(t, pkg.decls[initSymbol], 2)
+	// constants are kept together
+	assert.Same(t, pkg.decls["A"][0].node, pkg.decls["B"][0].node)
+}
+
+func TestChangedDeclarations(t *testing.T) {
+	const base = `package foo
+
+import "strings"
+
+// A is a.
+func A() string { return strings.ToUpper("a") }
+
+func B() string { return "b" }
+
+const (
+	C = iota
+	D
+)
+`
+
+	tests := []struct {
+		name     string
+		then     map[string]string
+		now      map[string]string
+		expected []string
+	}{
+		{
+			name: "unchanged",
+			then: map[string]string{"foo.go": base},
+			now:  map[string]string{"foo.go": base},
+		},
+		{
+			name: "comments and formatting",
+			then: map[string]string{"foo.go": base},
+			now: map[string]string{"foo.go": `package foo
+import "strings"
+// A returns A.
+func A() string {
+	return strings.ToUpper("a")
+}
+func B() string { return "b" }
+const (
+	C = iota // zero
+	D
+)
+`},
+		},
+		{
+			name: "body",
+			then: map[string]string{"foo.go": base},
+			now: map[string]string{"foo.go": `package foo
+import "strings"
+func A() string { return strings.ToUpper("a") }
+func B() string { return "B" }
+const (
+	C = iota
+	D
+)
+`},
+			expected: []string{"B"},
+		},
+		{
+			name: "constant group",
+			then: map[string]string{"foo.go": base},
+			now: map[string]string{"foo.go": `package foo
+import "strings"
+func A() string { return strings.ToUpper("a") }
+func B() string { return "b" }
+const (
+	_ = iota
+	C
+	D
+)
+`},
+			expected: []string{"C", "D", "_"},
+		},
+		{
+			name: "added and removed",
+			then: map[string]string{"foo.go": base},
+			now: map[string]string{"foo.go": `package foo
+import "strings"
+func A() string { return strings.ToUpper("a") }
+func E() string { return "b" }
+const (
+	C = iota
+	D
+)
+`},
+			expected: []string{"B", "E"},
+		},
+		{
+			name: "moved to another file",
+			then: map[string]string{"foo.go": base},
+			now: map[string]string{
+				"foo.go": `package foo
+import "strings"
+func A() string { return strings.ToUpper("a") }
+const (
+	C = iota
+	D
+)
+`,
+				"b.go": `package foo
+func B() string { return "b" }
+`,
+			},
+		},
+		{
+			name: "imported package",
+			then: map[string]string{"foo.go": base},
+			now: map[string]string{"foo.go": `package foo
+import strings "example.com/strings"
+func A() string { return strings.ToUpper("a") }
+func B() string { return "b" }
+const (
+	C = iota
+	D
+)
+`},
+			expected: []string{"A"},
+		},
+		{
+			name:     "directive",
+			then:     map[string]string{"foo.go": base},
+			now:      map[string]string{"foo.go": "//go:build linux\n\n" + base},
+			expected: []string{"A", "B", "C", "D"},
+		},
+		{
+			name:     "test helper",
+			then:     map[string]string{"foo.go": base, "foo_test.go": "package foo\nfunc B() {}\n"},
+			now:      map[string]string{"foo.go": base, "foo_test.go": "package foo\nfunc B() { println() }\n"},
+			expected: []string{"test:B"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changed := changedDeclarations(newSymbolPackage(t, test.now), newSymbolPackage(t, test.then))
+			assert.Equal(t, test.expected, keys(changed))
+		})
+	}
+}
+
+func TestSymbolClosure(t *testing.T) {
+	pkg := newSymbolPackage(t, map[string]string{
+		"foo.go": `package foo
+func A() int { return b() }
+func b() int { return 1 }
+func C() int { return A() + 1 }
+func D() int { return 4 }
+type T struct{ x int }
+func (t T) Value() int { return b() }
+type U struct{ t T }
+func E(s struct{ b int }) int { return s.b }
+var F = C()
+`,
+		"foo_test.go": `package foo
+func helper() int { return b() }
+func other() int { return 0 }
+`,
+		"foo_ext_test.go": `package foo_test
+func b() int { return 2 }
+func G() int { return b() }
+`,
+	})
+
+	tests := []struct {
+		name     string
+		seeds    []string
+		expected []string
+	}{
+		{
+			name:     "unexported function",
+			seeds:    []string{"b"},
+			expected: []string{"A", "C", "F", "T", "T.Value", "U", "b", "test:helper"},
+		},
+		{
+			name:     "unreferenced function",
+			seeds:    []string{"D"},
+			expected: []string{"D"},
+		},
+		{
+			name:     "method",
+			seeds:    []string{"T.Value"},
+			expected: []string{"T", "T.Value", "U"},
+		},
+		{
+			name:     "test helper",
+			seeds:    []string{"test:other"},
+			expected: []string{"test:other"},
+		},
+		{
+			name:     "external test package",
+			seeds:    []string{"xtest:b"},
+			expected: []string{"xtest:G", "xtest:b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seeds := map[string]bool{}
+			for _, seed := range test.seeds {
+				seeds[seed] = true
+			}
+			assert.Equal(t, test.expected, keys(pkg.closure(seeds)))
+		})
+	}
+}
+
+func TestSymbolUses(t *testing.T) {
+	dependency := newSymbolPackage(t, map[string]string{
+		"bar.go": "package bar\nfunc A() {}\nfunc B() {}\n",
+	})
+
+	pkg := newSymbolPackage(t, map[string]string{
+		"foo.go": `package foo
+import "example.com/bar"
+func A() { bar.A() }
+func B() { bar.B() }
+func C() { var bar struct{ A func() }; _ = bar }
+`,
+		"named.go": `package foo
+import b "example.com/bar"
+func D() { b.A() }
+`,
+		"dot.go": `package foo
+import . "example.com/bar"
+func E() {}
+`,
+		"other.go": `package foo
+func F() {}
+`,
+	})
+
+	tests := []struct {
+		name     string
+		symbols  []string
+		expected []string
+	}{
+		{
+			name:     "qualified",
+			symbols:  []string{"A"},
+			expected: []string{"A", "D", "E"},
+		},
+		{
+			name:     "unused",
+			symbols:  []string{"C"},
+			expected: []string{"E"},
+		},
+		{
+			name:     "init",
+			symbols:  []string{initSymbol},
+			expected: []string{"E", initSymbol},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			symbols := map[string]bool{}
+			for _, symbol := range test.symbols {
+				symbols[symbol] = true
+			}
+			assert.Equal(t, test.expected, keys(pkg.uses("example.com/bar", dependency, symbols)))
+		})
+	}
+}
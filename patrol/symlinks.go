@@ -0,0 +1,149 @@
+package patrol
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// addSymlink records the symlink at p (name relative to the repo root) if it
+// points to a file or directory within the repo.
+func (r *Repo) addSymlink(p, name string, isDir bool) error {
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.EvalSymlinks(r.path)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// outside the repo, changes to it can't be detected
+		return nil
+	}
+
+	r.symlinks[name] = filepath.ToSlash(rel)
+	r.linkedDirs[name] = isDir
+	return nil
+}
+
+// maxSymlinks is the number of symlinks followed to resolve a path before
+// giving up, as the operating system does.
+const maxSymlinks = 255
+
+// resolveTreeSymlink returns the name (relative to the repo root) of the file
+// or directory the symlink with the given name within tree (the tree of the
+// repo root) points to, following any other symlink on the way, and whether
+// it's a directory. It returns false if the symlink points outside the repo
+// or to nothing.
+func resolveTreeSymlink(tree *object.Tree, name string) (string, bool, bool, error) {
+	resolved := path.Dir(name)
+	rest := []string{path.Base(name)}
+	isDir := true
+
+	for hops := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." || !isDir {
+				return "", false, false, nil
+			}
+			resolved, isDir = path.Dir(resolved), true
+			continue
+		}
+
+		next := path.Join(resolved, elem)
+		entry, err := tree.FindEntry(next)
+		if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+			return "", false, false, nil
+		}
+		if err != nil {
+			return "", false, false, err
+		}
+
+		if entry.Mode == filemode.Symlink {
+			if hops++; hops > maxSymlinks {
+				return "", false, false, nil
+			}
+
+			f, err := tree.TreeEntryFile(entry)
+			if err != nil {
+				return "", false, false, err
+			}
+			target, err := f.Contents()
+			if err != nil {
+				return "", false, false, err
+			}
+			if path.IsAbs(target) {
+				// outside the repo, changes to it can't be detected
+				return "", false, false, nil
+			}
+
+			// the target is relative to the directory of the symlink
+			rest = append(strings.Split(target, "/"), rest...)
+			continue
+		}
+
+		if !isDir {
+			// a file can't contain anything
+			return "", false, false, nil
+		}
+		resolved, isDir = next, entry.Mode == filemode.Dir
+	}
+
+	return resolved, isDir, true, nil
+}
+
+// aliases returns the other names the file with the given name (relative to
+// the repo root) can be reached with, through symlinks, sorted.
+func (r *Repo) aliases(name string) []string {
+	var aliases []string
+	for link, target := range r.symlinks {
+		if name == target {
+			aliases = append(aliases, link)
+		} else if strings.HasPrefix(name, target+"/") {
+			aliases = append(aliases, link+strings.TrimPrefix(name, target))
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// linkedPackages returns the names of the packages read through the symlink
+// to a directory with the given name, sorted.
+func (r *Repo) linkedPackages(name string) []string {
+	var names []string
+	for _, pkg := range r.Packages {
+		if pkg.PartOfModule && (pkg.Dir == name || strings.HasPrefix(pkg.Dir, name+"/")) {
+			names = append(names, pkg.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagLinkedPackages flags as changed the packages read through the symlink
+// to a directory with the given name, returning false if it isn't one.
+func (r *Repo) flagLinkedPackages(name string) bool {
+	if !r.linkedDirs[name] {
+		return false
+	}
+
+	for _, pkgName := range r.linkedPackages(name) {
+		r.logf("symlink %s changed, flagging %s", name, pkgName)
+		r.flagPackageAsChanged(pkgName, ChangedAPI)
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package patrol_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestSymlinks(t *testing.T) {
+	const module = "github.com/utilitywarehouse/symlinks"
+
+	tmp, commits := newTestRepo(t, "testdata/symlinks/commits/1")
+
+	// the generated code is shared through symlinks, one of them pointing
+	// to a parent directory
+	for link, target := range map[string]string{
+		"svc/a/gen":           "../../proto/gen",
+		"svc/b/gen":           "../../proto/gen",
+		"svc/loop":            "..",
+		"pkg/shared/gen.go":   "../../proto/gen/gen.go",
+		"pkg/shared/dangling": "../../nowhere",
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(tmp, filepath.FromSlash(link))))
+	}
+	runGit(t, tmp, "add", "-A")
+	runGit(t, tmp, "commit", "-q", "-m", "symlinks")
+	commits = append(commits, runGit(t, tmp, "rev-parse", "HEAD"))
+
+	require.NoError(t, copy("testdata/symlinks/commits/2", tmp))
+	runGit(t, tmp, "add", "-A")
+	runGit(t, tmp, "commit", "-q", "-m", "change")
+
+	expected := expectedChanges(t, "testdata/symlinks/commits/2")
+
+	// packages are read through symlinks from the working tree as well as
+	// from git
+	tests := []struct {
+		name    string
+		options []patrol.Option
+		load    string
+	}{
+		{name: "working tree"},
+		{name: "target", options: []patrol.Option{patrol.Target("HEAD")}},
+		{name: "loaded revision", options: []patrol.Option{patrol.Target(commits[1])}, load: "HEAD"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, err := patrol.NewRepo(tmp, test.options...)
+			require.NoError(t, err)
+			if test.load != "" {
+				require.NoError(t, repo.LoadRevision(test.load))
+			}
+
+			assert.Contains(t, repo.Packages, module+"/svc/a/gen")
+			assert.Contains(t, repo.Packages, module+"/svc/b/gen")
+			assert.NotContains(t, repo.Packages, module+"/svc/loop/a")
+
+			changes, err := repo.Changes(context.Background(), commits[1])
+			require.NoError(t, err)
+			assert.ElementsMatch(t, expected, changes)
+		})
+	}
+
+	t.Run("log", func(t *testing.T) {
+		// symlinks are read from each commit, not from the packages loaded
+		repo, err := patrol.NewRepo(tmp, patrol.Target(commits[0]))
+		require.NoError(t, err)
+
+		log, err := repo.Log(commits[1], "HEAD", false, false)
+		require.NoError(t, err)
+		require.Len(t, log, 1)
+		assert.ElementsMatch(t, expected, log[0].Changes)
+	})
+
+	// pointing a symlink somewhere else changes what's read through it
+	repo, err := patrol.NewRepo(tmp)
+	require.NoError(t, err)
+
+	changes, err := repo.ChangesFromFiles(context.Background(), []string{"svc/a/gen"}, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{module + "/svc/a", module + "/svc/a/gen"}, changes)
+}
@@ -0,0 +1,14 @@
+package foo
+
+type Result struct {
+	Value int
+	cache int
+}
+
+func Sum(a, b int) int {
+	return add(a, b)
+}
+
+func add(a, b int) int {
+	return a + b
+}
@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/apisurface
+
+go 1.17
@@ -0,0 +1,18 @@
+package foo
+
+type Result struct {
+	Value int
+	extra bool
+}
+
+func Sum(x, y int) int {
+	return add(y, x)
+}
+
+func add(a, b int) int {
+	return b + a
+}
+
+func sub(a, b int) int {
+	return a - b
+}
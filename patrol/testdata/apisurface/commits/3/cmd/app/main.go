@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/utilitywarehouse/apisurface/pkg/bar"
+)
+
+func main() {
+	fmt.Println(bar.Three())
+}
@@ -0,0 +1 @@
+unsigned int hash(char *s);
@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/cgo
+
+go 1.17
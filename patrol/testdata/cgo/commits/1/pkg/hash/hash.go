@@ -0,0 +1,10 @@
+package hash
+
+// #cgo CFLAGS: -I${SRCDIR}/../../csrc/include
+// #cgo linux pkg-config: zstd-vendored
+// #include "hash.h"
+import "C"
+
+func Hash(s string) uint32 {
+	return uint32(C.hash(C.CString(s)))
+}
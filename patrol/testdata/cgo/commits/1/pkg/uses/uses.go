@@ -0,0 +1,5 @@
+package uses
+
+import "github.com/utilitywarehouse/cgo/pkg/hash"
+
+var H = hash.Hash("uses")
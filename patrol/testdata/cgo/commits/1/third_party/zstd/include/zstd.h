@@ -0,0 +1 @@
+int zstd(void);
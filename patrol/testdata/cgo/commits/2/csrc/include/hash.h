@@ -0,0 +1,2 @@
+unsigned int hash(char *s);
+unsigned int hash2(char *s);
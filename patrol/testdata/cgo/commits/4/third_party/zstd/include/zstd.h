@@ -0,0 +1,2 @@
+int zstd(void);
+int zstd2(void);
@@ -0,0 +1,7 @@
+#include "hash.h"
+
+unsigned int hash(char *s) {
+	unsigned int h = 0;
+	while (*s) h = h * 33 + *s++;
+	return h;
+}
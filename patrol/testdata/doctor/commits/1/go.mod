@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/doctor
+
+go 1.17
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/utilitywarehouse/doctor/pkg/a"
+	"github.com/utilitywarehouse/doctor/pkg/c"
+	"github.com/utilitywarehouse/doctor/pkg/empty"
+	"github.com/utilitywarehouse/doctor/pkg/missing"
+)
+
+func main() {
+	a.A()
+	c.C()
+	empty.Empty()
+	missing.Missing()
+}
@@ -0,0 +1,11 @@
+package a
+
+import (
+	"github.com/utilitywarehouse/doctor/pkg/b"
+	"github.com/utilitywarehouse/doctor/pkg/self"
+)
+
+func A() {
+	b.B()
+	self.Self()
+}
@@ -0,0 +1,7 @@
+package b
+
+import "github.com/utilitywarehouse/doctor/pkg/a"
+
+func B() {
+	a.A()
+}
@@ -0,0 +1,11 @@
+package c_test
+
+import (
+	"testing"
+
+	"github.com/utilitywarehouse/doctor/pkg/d"
+)
+
+func TestC(t *testing.T) {
+	d.D()
+}
@@ -0,0 +1,7 @@
+package d
+
+import "github.com/utilitywarehouse/doctor/pkg/c"
+
+func D() {
+	c.C()
+}
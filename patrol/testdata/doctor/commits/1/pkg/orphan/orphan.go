@@ -0,0 +1,3 @@
+package orphan
+
+func Orphan() {}
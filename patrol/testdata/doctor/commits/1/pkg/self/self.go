@@ -0,0 +1,7 @@
+package self
+
+import "github.com/utilitywarehouse/doctor/pkg/self"
+
+func Self() {
+	self.Self()
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/utilitywarehouse/gitsubmodules/libs/lib/bar"
+
+func main() {
+	bar.Bar()
+}
@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/gitsubmodules
+
+go 1.17
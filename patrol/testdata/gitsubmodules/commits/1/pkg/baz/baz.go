@@ -0,0 +1,7 @@
+package baz
+
+import "github.com/utilitywarehouse/gitsubmodules/libs/lib/foo"
+
+func Baz() {
+	foo.Foo()
+}
@@ -0,0 +1,7 @@
+package bar
+
+import "fmt"
+
+func Bar() {
+	fmt.Println("bar")
+}
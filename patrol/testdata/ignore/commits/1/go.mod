@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/ignore
+
+go 1.22
@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/internalchange
+
+go 1.17
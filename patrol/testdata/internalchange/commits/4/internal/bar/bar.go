@@ -0,0 +1,7 @@
+package bar
+
+type Bar struct{}
+
+func New() *Bar {
+	return &Bar{}
+}
@@ -0,0 +1,5 @@
+package bar
+
+type Other struct {
+	Name string
+}
@@ -0,0 +1,7 @@
+package cat
+
+import "github.com/utilitywarehouse/internalchange/pkg/foo"
+
+type Cat struct {
+	foo foo.Foo
+}
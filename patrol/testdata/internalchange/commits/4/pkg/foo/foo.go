@@ -0,0 +1,11 @@
+package foo
+
+import "github.com/utilitywarehouse/internalchange/internal/bar"
+
+type Foo struct {
+	Bar bar.Bar
+}
+
+func New() *Foo {
+	return &Foo{Bar: *bar.New()}
+}
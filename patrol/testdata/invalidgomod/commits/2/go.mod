@@ -0,0 +1,5 @@
+module github.com/utilitywarehouse/invalidgomod
+
+go 1.17
+
+require example.com/dep v1.0.0
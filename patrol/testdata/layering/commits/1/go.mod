@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/layering
+
+go 1.17
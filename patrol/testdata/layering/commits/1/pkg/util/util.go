@@ -0,0 +1,7 @@
+package util
+
+import "strings"
+
+func Normalise(s string) string {
+	return strings.ToLower(s)
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/utilitywarehouse/layering/pkg/util"
+	"github.com/utilitywarehouse/layering/services/a/internal/handler"
+)
+
+func main() {
+	util.Normalise("a")
+	handler.Handle()
+}
@@ -0,0 +1,7 @@
+package handler
+
+import "github.com/utilitywarehouse/layering/internal/legacy"
+
+func Handle() {
+	legacy.Handle()
+}
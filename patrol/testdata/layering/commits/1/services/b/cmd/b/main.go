@@ -0,0 +1,7 @@
+package main
+
+import "github.com/utilitywarehouse/layering/pkg/util"
+
+func main() {
+	util.Normalise("b")
+}
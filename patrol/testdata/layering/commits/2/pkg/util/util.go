@@ -0,0 +1,12 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/utilitywarehouse/layering/services/a/internal/handler"
+)
+
+func Normalise(s string) string {
+	handler.Handle()
+	return strings.ToLower(s)
+}
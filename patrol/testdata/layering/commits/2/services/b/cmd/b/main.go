@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/utilitywarehouse/layering/internal/legacy"
+	"github.com/utilitywarehouse/layering/pkg/util"
+	"github.com/utilitywarehouse/layering/services/a/internal/handler"
+)
+
+func main() {
+	util.Normalise("b")
+	handler.Handle()
+	legacy.Handle()
+}
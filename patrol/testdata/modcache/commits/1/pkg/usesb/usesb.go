@@ -0,0 +1,7 @@
+package usesb
+
+import "example.com/dep/b"
+
+func Double() int {
+	return b.B()
+}
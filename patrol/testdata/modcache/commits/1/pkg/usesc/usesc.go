@@ -0,0 +1,7 @@
+package usesc
+
+import "example.com/dep/c"
+
+func Three() int {
+	return c.C()
+}
@@ -0,0 +1,5 @@
+module github.com/utilitywarehouse/modcache
+
+go 1.17
+
+require example.com/dep v1.1.0
@@ -0,0 +1,5 @@
+package c
+
+func C() int {
+	return 3
+}
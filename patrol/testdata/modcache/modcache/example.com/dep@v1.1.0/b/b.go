@@ -0,0 +1,7 @@
+package b
+
+import "example.com/dep/a"
+
+func B() int {
+	return a.A() * 2
+}
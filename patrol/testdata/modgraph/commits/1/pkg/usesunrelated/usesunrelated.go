@@ -0,0 +1,7 @@
+package usesunrelated
+
+import "example.com/unrelated"
+
+func U() int {
+	return unrelated.U()
+}
@@ -0,0 +1,10 @@
+module github.com/utilitywarehouse/modgraph
+
+go 1.17
+
+require (
+	example.com/direct v1.0.0
+	example.com/unrelated v1.0.0
+)
+
+require example.com/indirect v1.1.0 // indirect
@@ -0,0 +1,7 @@
+package usesdirect
+
+import "example.com/direct/x"
+
+func X() int {
+	return x.X()
+}
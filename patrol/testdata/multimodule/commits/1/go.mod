@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/multimodule
+
+go 1.14
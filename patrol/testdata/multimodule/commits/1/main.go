@@ -0,0 +1,7 @@
+package main
+
+import "github.com/utilitywarehouse/multimodule/pkg/foo"
+
+func main() {
+	foo.Foo()
+}
@@ -0,0 +1,5 @@
+package foo
+
+func Foo() string {
+	return "foo"
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/utilitywarehouse/multimodule/pkg/foo"
+)
+
+func main() {
+	fmt.Println(foo.Foo())
+}
@@ -0,0 +1,7 @@
+module example.com/tools
+
+go 1.14
+
+require github.com/utilitywarehouse/multimodule v0.0.0
+
+replace github.com/utilitywarehouse/multimodule => ../
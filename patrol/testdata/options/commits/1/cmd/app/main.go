@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/utilitywarehouse/options/pkg/baz"
+	"github.com/utilitywarehouse/options/pkg/foo"
+)
+
+func main() {
+	foo.Foo()
+	baz.Baz()
+}
@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/options
+
+go 1.17
@@ -0,0 +1,3 @@
+package baz
+
+func Baz() {}
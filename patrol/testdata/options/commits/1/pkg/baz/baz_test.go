@@ -0,0 +1,11 @@
+package baz_test
+
+import (
+	"testing"
+
+	"github.com/utilitywarehouse/options/pkg/qux"
+)
+
+func TestBaz(t *testing.T) {
+	qux.Qux()
+}
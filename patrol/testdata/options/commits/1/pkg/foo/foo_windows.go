@@ -0,0 +1,3 @@
+package foo
+
+var windows = false
@@ -0,0 +1,3 @@
+package qux
+
+func Qux() {}
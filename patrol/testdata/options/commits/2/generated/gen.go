@@ -0,0 +1,3 @@
+package generated
+
+const Version = 2
@@ -0,0 +1,5 @@
+package qux
+
+func Qux() {
+	println("qux!")
+}
@@ -0,0 +1,5 @@
+package foo
+
+func Sum(a, b int) int {
+	return a + b
+}
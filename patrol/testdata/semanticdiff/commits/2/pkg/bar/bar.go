@@ -0,0 +1,7 @@
+package bar
+
+import "github.com/utilitywarehouse/semanticdiff/pkg/foo"
+
+func Three() int {
+	return foo.Sum(1, 2)
+}
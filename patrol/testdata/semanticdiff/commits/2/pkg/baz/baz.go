@@ -0,0 +1,5 @@
+package baz
+
+func Double(a int) int {
+	return a * 2
+}
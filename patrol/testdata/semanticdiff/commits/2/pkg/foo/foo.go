@@ -0,0 +1,10 @@
+// Package foo does maths.
+package foo
+
+// Sum returns the sum of a and b.
+func Sum(
+	a, b int,
+) int {
+	return a +
+		b // no overflow checks
+}
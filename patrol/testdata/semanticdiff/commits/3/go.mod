@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/semanticdiff
+
+go 1.17
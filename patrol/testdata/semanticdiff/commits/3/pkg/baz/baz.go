@@ -0,0 +1,6 @@
+package baz
+
+//go:noinline
+func Double(a int) int {
+	return a * 2
+}
@@ -0,0 +1,7 @@
+// Package foo does maths.
+package foo
+
+// Sum returns the sum of a and b.
+func Sum(a, b int) int {
+	return b + a
+}
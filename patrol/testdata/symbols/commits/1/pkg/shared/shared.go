@@ -0,0 +1,23 @@
+package shared
+
+func A() int {
+	return helper()
+}
+
+func B() int {
+	return 2
+}
+
+func helper() int {
+	return 1
+}
+
+type T struct{}
+
+func NewT() T {
+	return T{}
+}
+
+func (T) M() int {
+	return 1
+}
@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/symbols
+
+go 1.17
@@ -0,0 +1,7 @@
+package usesa
+
+import "github.com/utilitywarehouse/symbols/pkg/shared"
+
+func X() int {
+	return shared.A()
+}
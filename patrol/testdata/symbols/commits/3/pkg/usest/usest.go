@@ -0,0 +1,7 @@
+package usest
+
+import s "github.com/utilitywarehouse/symbols/pkg/shared"
+
+func W() int {
+	return s.NewT().M()
+}
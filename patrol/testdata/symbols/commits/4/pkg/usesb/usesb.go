@@ -0,0 +1,7 @@
+package usesb
+
+import "github.com/utilitywarehouse/symbols/pkg/shared"
+
+func Y() int {
+	return shared.B()
+}
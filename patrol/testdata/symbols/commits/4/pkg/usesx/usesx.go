@@ -0,0 +1,7 @@
+package usesx
+
+import "github.com/utilitywarehouse/symbols/pkg/usesa"
+
+func Z() int {
+	return usesa.X()
+}
@@ -0,0 +1,35 @@
+package shared
+
+func A() int {
+	return helper()
+}
+
+func B() int {
+	return 2
+}
+
+func helper() int {
+	return 10
+}
+
+type T struct{}
+
+func NewT() T {
+	return T{}
+}
+
+func (T) M() int {
+	return 100
+}
+
+var registry = map[string]int{}
+
+func init() {
+	registry["b"] = B()
+}
+
+var _ = check()
+
+func check() int {
+	return 2
+}
@@ -0,0 +1,14 @@
+package shared_test
+
+import "testing"
+
+// B has the same name as shared.B, but it's only a test helper
+func B() int {
+	return 3
+}
+
+func TestB(t *testing.T) {
+	if B() != 3 {
+		t.Fail()
+	}
+}
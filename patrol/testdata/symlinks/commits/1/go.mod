@@ -0,0 +1,3 @@
+module github.com/utilitywarehouse/symlinks
+
+go 1.17
@@ -0,0 +1,3 @@
+package gen
+
+type Message struct{}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/utilitywarehouse/symlinks/svc/a/gen"
+
+func main() {
+	_ = gen.Message{}
+}
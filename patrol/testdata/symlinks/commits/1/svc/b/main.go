@@ -0,0 +1,7 @@
+package main
+
+import "github.com/utilitywarehouse/symlinks/svc/b/gen"
+
+func main() {
+	_ = gen.Message{}
+}
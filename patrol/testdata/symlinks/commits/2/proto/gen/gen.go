@@ -0,0 +1,5 @@
+package gen
+
+type Message struct {
+	ID string
+}
@@ -0,0 +1,429 @@
+package patrol
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/mod/modfile"
+)
+
+// loadTree reads the packages of the repo from tree rather than from the
+// working tree. If packages were already read from another tree, only the
+// directories with changed .go files are parsed again, and the graph of
+// packages is kept (with its changes reset) if neither go.mod files nor
+// imports changed.
+func (r *Repo) loadTree(tree *object.Tree) error {
+	if r.tree == nil {
+		return r.loadFullTree(tree)
+	}
+
+	changes, err := r.tree.Diff(tree)
+	if err != nil {
+		return err
+	}
+
+	changedDirs := map[string]bool{}
+	for _, change := range changes {
+		if change.From.TreeEntry.Mode == filemode.Submodule || change.To.TreeEntry.Mode == filemode.Submodule {
+			// a submodule points to another commit, any of its files might
+			// have changed
+			return r.loadFullTree(tree)
+		}
+		if change.From.TreeEntry.Mode == filemode.Symlink || change.To.TreeEntry.Mode == filemode.Symlink {
+			// what's read through the symlink changed
+			return r.loadFullTree(tree)
+		}
+
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name == "" {
+				continue
+			}
+			if path.Base(name) == "go.mod" {
+				// module paths (and requirements) might have changed, which
+				// changes the name of packages and their dependencies
+				return r.loadFullTree(tree)
+			}
+			if path.Ext(name) == ".pc" {
+				// the files pkg-config packages refer to might have changed
+				return r.loadFullTree(tree)
+			}
+			if len(r.aliases(name)) > 0 {
+				// the packages reached through symlinks changed too
+				return r.loadFullTree(tree)
+			}
+			if strings.HasSuffix(name, ".go") {
+				changedDirs[path.Dir(name)] = true
+			}
+		}
+	}
+
+	r.tree = tree
+
+	graphChanged := false
+	for dir := range changedDirs {
+		sources, err := r.parseTreeDir(tree, dir)
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(withoutPositions(sources), withoutPositions(r.sources[dir])) {
+			graphChanged = true
+		}
+
+		if len(sources) == 0 {
+			delete(r.sources, dir)
+		} else {
+			r.sources[dir] = sources
+		}
+	}
+
+	if graphChanged {
+		r.Packages = map[string]*Package{}
+		r.addPackages(r.sources)
+	}
+
+	r.resetChanges()
+	return nil
+}
+
+// withoutPositions returns a copy of sources without the positions of their
+// imports, which don't matter to the graph of packages.
+func withoutPositions(sources []sourcePackage) []sourcePackage {
+	result := make([]sourcePackage, len(sources))
+	for i, src := range sources {
+		src.positions = nil
+		result[i] = src
+	}
+	return result
+}
+
+// loadFullTree reads the module and all packages of the repo from tree.
+func (r *Repo) loadFullTree(tree *object.Tree) error {
+	b, err := treeFileContents(tree, "go.mod")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return fmt.Errorf("%w: %w", ErrGoModNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	mod, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		return &ParseError{Path: "go.mod", Err: err}
+	}
+
+	r.tree = tree
+	r.Module = mod
+	r.modules = map[string]string{}
+	r.sources = map[string][]sourcePackage{}
+	r.pkgConfigs = map[string][]string{}
+	r.symlinks = map[string]string{}
+	r.linkedDirs = map[string]bool{}
+
+	goFiles := map[string][]*object.File{}
+	err = r.forEachTreeFile(tree, func(f *object.File) error {
+		dir := path.Dir(f.Name)
+		if directoryShouldBeIgnored(dir) || r.ignored(f.Name) {
+			return nil
+		}
+
+		if path.Base(f.Name) == "go.mod" && dir != "." && !inTestdata(dir) {
+			contents, err := f.Contents()
+			if err != nil {
+				return err
+			}
+
+			nested, err := modfile.ParseLax(f.Name, []byte(contents), nil)
+			if err != nil {
+				return r.parseError(f.Name, err)
+			}
+			if nested.Module != nil {
+				r.modules[dir] = nested.Module.Mod.Path
+			}
+		}
+
+		if strings.HasSuffix(f.Name, ".go") {
+			goFiles[dir] = append(goFiles[dir], f)
+		}
+
+		if path.Ext(f.Name) == ".pc" {
+			contents, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			r.addPkgConfig(f.Name, []byte(contents))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for dir, files := range goFiles {
+		sources, err := r.parseSourcePackages(files)
+		if err != nil {
+			return err
+		}
+		r.sources[dir] = sources
+	}
+
+	r.Packages = map[string]*Package{}
+	r.addPackages(r.sources)
+	r.resetChanges()
+
+	return nil
+}
+
+// forEachTreeFile calls fn with each file within tree, including the files
+// of the submodules it points to (recursively) if they're checked out, named
+// relative to the root of the repo. Symlinks within the repo are followed
+// (and recorded), so files are passed to fn once for every path reaching
+// them.
+func (r *Repo) forEachTreeFile(tree *object.Tree, fn func(f *object.File) error) error {
+	if err := r.walkTree(tree, tree, ".", ".", map[string]bool{}, fn); err != nil {
+		return err
+	}
+
+	var g *goGit
+	return forEachSubmodule(tree, func(dir string, link plumbing.Hash) error {
+		if g == nil {
+			var err error
+			if g, err = r.openGoGit(); err != nil {
+				return err
+			}
+		}
+		return forEachSubmoduleFile(g, dir, link.String(), fn)
+	})
+}
+
+// walkTree calls fn with each file within dirTree, the tree of the directory
+// realDir within root (the tree of the repo root), named as if it was found
+// in dir, following symlinks. ancestors holds the directories being walked
+// (by their real name), so that symlinks pointing to any of them aren't
+// followed again.
+func (r *Repo) walkTree(root, dirTree *object.Tree, realDir, dir string, ancestors map[string]bool, fn func(f *object.File) error) error {
+	ancestors[realDir] = true
+	defer delete(ancestors, realDir)
+
+	for i := range dirTree.Entries {
+		entry := &dirTree.Entries[i]
+		realName, name := path.Join(realDir, entry.Name), path.Join(dir, entry.Name)
+
+		switch {
+		case entry.Mode == filemode.Dir:
+			subtree, err := dirTree.Tree(entry.Name)
+			if err != nil {
+				return err
+			}
+			if err := r.walkTree(root, subtree, realName, name, ancestors, fn); err != nil {
+				return err
+			}
+
+		case entry.Mode == filemode.Symlink:
+			target, isDir, ok, err := resolveTreeSymlink(root, realName)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// dangling, or pointing outside the repo
+				continue
+			}
+			r.symlinks[name] = target
+			r.linkedDirs[name] = isDir
+
+			if !isDir {
+				f, err := root.File(target)
+				if err != nil {
+					return err
+				}
+				f.Name = name
+				if err := fn(f); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if ancestors[target] {
+				r.logf("not following %s, it points to one of its parents", name)
+				continue
+			}
+			subtree := root
+			if target != "." {
+				if subtree, err = root.Tree(target); err != nil {
+					return err
+				}
+			}
+			if err := r.walkTree(root, subtree, target, name, ancestors, fn); err != nil {
+				return err
+			}
+
+		case entry.Mode.IsFile():
+			f, err := dirTree.TreeEntryFile(entry)
+			if err != nil {
+				return err
+			}
+			f.Name = name
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// forEachSubmoduleFile calls fn with each file of the submodule checked out at
+// dir within the repo of g, at the given commit (and of its own submodules),
+// named relative to the root of that repo.
+func forEachSubmoduleFile(g *goGit, dir, commit string, fn func(f *object.File) error) error {
+	sub, err := g.openSubmodule(dir)
+	if sub == nil || err != nil {
+		return err
+	}
+
+	tree, err := sub.tree(commit)
+	if err != nil {
+		return fmt.Errorf("submodule %s: %w", dir, err)
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		f.Name = path.Join(dir, f.Name)
+		return fn(f)
+	})
+	if err != nil {
+		return err
+	}
+
+	return forEachSubmodule(tree, func(subDir string, link plumbing.Hash) error {
+		return forEachSubmoduleFile(sub, subDir, link.String(), func(f *object.File) error {
+			f.Name = path.Join(dir, f.Name)
+			return fn(f)
+		})
+	})
+}
+
+// forEachSubmodule calls fn with the directory of each submodule within tree
+// and the commit it points to.
+func forEachSubmodule(tree *object.Tree, fn func(dir string, link plumbing.Hash) error) error {
+	if _, err := tree.FindEntry(".gitmodules"); err != nil {
+		// no submodules, no need to walk the whole tree again
+		return nil
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode == filemode.Submodule {
+			if err := fn(name, entry.Hash); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resetChanges clears the changes flagged by a previous call to ChangesFrom.
+func (r *Repo) resetChanges() {
+	for _, pkg := range r.Packages {
+		pkg.Changed = false
+		pkg.ChangeKind = Unchanged
+		pkg.Reason = ""
+		pkg.direct = false
+	}
+	r.changedModules = nil
+}
+
+// parseTreeDir returns the packages found in dir within tree, if any.
+func (r *Repo) parseTreeDir(tree *object.Tree, dir string) ([]sourcePackage, error) {
+	if dir != "." {
+		var err error
+		tree, err = tree.Tree(dir)
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var files []*object.File
+	for _, entry := range tree.Entries {
+		if !entry.Mode.IsFile() || entry.Mode == filemode.Symlink || !strings.HasSuffix(entry.Name, ".go") {
+			continue
+		}
+
+		f, err := tree.TreeEntryFile(&entry)
+		if err != nil {
+			return nil, err
+		}
+		f.Name = path.Join(dir, f.Name)
+		files = append(files, f)
+	}
+
+	return r.parseSourcePackages(files)
+}
+
+// parseSourcePackages parses the imports of the given .go files (all from
+// the same directory) and groups them by package.
+func (r *Repo) parseSourcePackages(files []*object.File) ([]sourcePackage, error) {
+	fset := token.NewFileSet()
+
+	var sources []sourcePackage
+	for _, f := range files {
+		contents, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		if r.ignored(f.Name) || !r.matchesBuildContext(f.Name, []byte(contents)) {
+			continue
+		}
+
+		file, err := parseImports(fset, f.Name, []byte(contents))
+		if err != nil {
+			if err := r.parseError(f.Name, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		sources, err = r.addSourceFile(sources, fset, file, path.Dir(f.Name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sources, nil
+}
+
+// treeFileContents returns the contents of the file with the given name
+// within tree.
+func treeFileContents(tree *object.Tree, name string) ([]byte, error) {
+	f, err := tree.File(name)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(contents), nil
+}
@@ -0,0 +1,416 @@
+package patrol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// VCSBackend is the implementation used to read revisions, diffs and files
+// from git when detecting changes.
+type VCSBackend string
+
+const (
+	// VCSGoGit reads the repository with go-git. This is the default backend.
+	VCSGoGit VCSBackend = "go-git"
+	// VCSGit runs the git command, which is much faster than go-git on large
+	// repositories and supports partial and sparse clones.
+	VCSGit VCSBackend = "git"
+)
+
+// VCS sets the backend used to detect changes (VCSGoGit by default).
+func VCS(backend VCSBackend) Option {
+	return func(r *Repo) {
+		r.vcsBackend = backend
+	}
+}
+
+// vcs is what detecting changes needs from the version control system.
+// Commits are identified by the hashes returned by resolveRevision, and file
+// names are relative to the root of the repo and slash separated. Methods
+// taking a context stop (returning ctx.Err()) once it's done.
+type vcs interface {
+	// resolveRevision returns the hash of the commit revision points to, or
+	// an error wrapping ErrRevisionNotFound if there's no such commit.
+	resolveRevision(ctx context.Context, revision string) (string, error)
+
+	// changedFiles returns the files that differ between the commits then
+	// and now, either of which can be empty (for an empty tree).
+	changedFiles(ctx context.Context, then, now string) ([]fileChange, error)
+
+	// readFile returns the contents of the file with the given name at
+	// commit, or an error wrapping os.ErrNotExist if there's no such file.
+	readFile(ctx context.Context, commit, name string) ([]byte, error)
+
+	// readDir returns the names of the regular files (symlinks excluded) in
+	// dir at commit, sorted. It returns nil if there's no such directory.
+	readDir(ctx context.Context, commit, dir string) ([]string, error)
+
+	// mergeBase returns the best common ancestor of the two commits, or an
+	// empty string if they have none.
+	mergeBase(ctx context.Context, a, b string) (string, error)
+
+	// worktreeChanges returns the files with uncommitted changes (untracked
+	// files included), sorted.
+	worktreeChanges(ctx context.Context) ([]string, error)
+
+	// gitlink returns the commit the submodule at dir points to at commit,
+	// or an empty string if dir isn't a submodule there.
+	gitlink(ctx context.Context, commit, dir string) (string, error)
+
+	// submodule returns the repo of the submodule checked out at dir, or nil
+	// if there's none.
+	submodule(dir string) (vcs, error)
+}
+
+// fileChange is a file that differs between two commits, with its name in
+// each of them (empty if it was added or removed).
+type fileChange struct {
+	now, then string
+
+	// commits the submodule at now and then points to, if the change is to
+	// a submodule rather than a file
+	nowLink, thenLink string
+}
+
+// openVCS returns the backend changes are detected with, opening it the first
+// time it's needed.
+func (r *Repo) openVCS() (vcs, error) {
+	if r.vcs != nil {
+		return r.vcs, nil
+	}
+
+	var v vcs
+	var err error
+	switch r.vcsBackend {
+	case "", VCSGoGit:
+		v, err = r.openGoGit()
+	case VCSGit:
+		v, err = newGitCLI(r.path)
+	default:
+		err = fmt.Errorf("invalid VCS backend %q", r.vcsBackend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.vcs = submodules{v}
+	return r.vcs, nil
+}
+
+// openGoGit returns the repo opened with go-git, opening it the first time
+// it's needed. Commits and trees read through it are cached, so it's shared
+// by everything reading from git (whatever the VCS backend).
+func (r *Repo) openGoGit() (*goGit, error) {
+	if r.goGit != nil {
+		return r.goGit, nil
+	}
+
+	repo, err := git.PlainOpen(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.goGit = newGoGit(r.path, repo)
+	return r.goGit, nil
+}
+
+// goGit is the vcs implemented with go-git.
+type goGit struct {
+	repo *git.Repository
+
+	// dir is the root of the repo, where submodules are checked out
+	dir string
+
+	// submodules already opened (nil if not checked out), by directory
+	submodules map[string]*goGit
+
+	// commits already resolved, by revision (and by hash)
+	commits map[string]*object.Commit
+
+	// trees already read, by commit hash
+	trees map[string]*object.Tree
+}
+
+// newGoGit returns a goGit for repo, checked out at dir.
+func newGoGit(dir string, repo *git.Repository) *goGit {
+	return &goGit{
+		repo:       repo,
+		dir:        dir,
+		submodules: map[string]*goGit{},
+		commits:    map[string]*object.Commit{},
+		trees:      map[string]*object.Tree{},
+	}
+}
+
+// resolveCommit returns the commit the given revision points to.
+func (g *goGit) resolveCommit(revision string) (*object.Commit, error) {
+	if commit, ok := g.commits[revision]; ok {
+		return commit, nil
+	}
+
+	var hash plumbing.Hash
+	if plumbing.IsHash(revision) {
+		hash = plumbing.NewHash(revision)
+	} else {
+		h, err := g.repo.ResolveRevision(plumbing.Revision(revision))
+		if err != nil {
+			return nil, revisionNotFound(revision, err)
+		}
+		hash = *h
+	}
+
+	commit, err := g.repo.CommitObject(hash)
+	if err != nil {
+		return nil, revisionNotFound(revision, err)
+	}
+
+	g.commits[revision] = commit
+	g.commits[commit.Hash.String()] = commit
+	return commit, nil
+}
+
+func (g *goGit) resolveRevision(ctx context.Context, revision string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	commit, err := g.resolveCommit(revision)
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// tree returns the tree of the given commit, or nil if commit is empty.
+func (g *goGit) tree(commit string) (*object.Tree, error) {
+	if commit == "" {
+		return nil, nil
+	}
+
+	if tree, ok := g.trees[commit]; ok {
+		return tree, nil
+	}
+
+	c, err := g.resolveCommit(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, revisionNotFound(commit, err)
+	}
+
+	g.trees[commit] = tree
+	return tree, nil
+}
+
+func (g *goGit) changedFiles(ctx context.Context, then, now string) ([]fileChange, error) {
+	thenTree, err := g.tree(then)
+	if err != nil {
+		return nil, err
+	}
+
+	nowTree, err := g.tree(now)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := nowTree.DiffContext(ctx, thenTree)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, revisionNotFound(then, err)
+	}
+
+	changes := make([]fileChange, 0, len(diff))
+	for _, change := range diff {
+		// the diff is from now to then
+		var file, link fileChange
+		if change.From.Name != "" {
+			if change.From.TreeEntry.Mode == filemode.Submodule {
+				link.now, link.nowLink = change.From.Name, change.From.TreeEntry.Hash.String()
+			} else {
+				file.now = change.From.Name
+			}
+		}
+		if change.To.Name != "" {
+			if change.To.TreeEntry.Mode == filemode.Submodule {
+				link.then, link.thenLink = change.To.Name, change.To.TreeEntry.Hash.String()
+			} else {
+				file.then = change.To.Name
+			}
+		}
+
+		for _, c := range []fileChange{file, link} {
+			if c.now != "" || c.then != "" {
+				changes = append(changes, c)
+			}
+		}
+	}
+	return changes, nil
+}
+
+func (g *goGit) readFile(ctx context.Context, commit, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tree, err := g.tree(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := tree.File(name)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, revisionNotFound(commit, err)
+	}
+
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, revisionNotFound(commit, err)
+	}
+
+	return []byte(contents), nil
+}
+
+func (g *goGit) readDir(ctx context.Context, commit, dir string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tree, err := g.tree(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir != "." {
+		tree, err = tree.Tree(dir)
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, revisionNotFound(commit, err)
+		}
+	}
+
+	var names []string
+	for _, entry := range tree.Entries {
+		if entry.Mode.IsFile() && entry.Mode != filemode.Symlink {
+			names = append(names, entry.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (g *goGit) mergeBase(ctx context.Context, a, b string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	commitA, err := g.resolveCommit(a)
+	if err != nil {
+		return "", err
+	}
+
+	commitB, err := g.resolveCommit(b)
+	if err != nil {
+		return "", err
+	}
+
+	bases, err := commitA.MergeBase(commitB)
+	if err != nil {
+		return "", revisionNotFound(b, err)
+	}
+
+	if len(bases) == 0 {
+		return "", nil
+	}
+	return bases[0].Hash.String(), nil
+}
+
+func (g *goGit) worktreeChanges(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	worktree, err := g.repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, file := range status {
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (g *goGit) gitlink(ctx context.Context, commit, dir string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	tree, err := g.tree(commit)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := tree.FindEntry(dir)
+	if err != nil || entry.Mode != filemode.Submodule {
+		return "", nil
+	}
+	return entry.Hash.String(), nil
+}
+
+func (g *goGit) submodule(dir string) (vcs, error) {
+	sub, err := g.openSubmodule(dir)
+	if sub == nil || err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// openSubmodule returns the repo of the submodule checked out at dir, or nil
+// if there's none.
+func (g *goGit) openSubmodule(dir string) (*goGit, error) {
+	if sub, ok := g.submodules[dir]; ok {
+		return sub, nil
+	}
+
+	subDir := filepath.Join(g.dir, filepath.FromSlash(dir))
+	if _, err := os.Stat(filepath.Join(subDir, ".git")); err != nil {
+		g.submodules[dir] = nil
+		return nil, nil
+	}
+
+	repo, err := git.PlainOpen(subDir)
+	if err != nil {
+		return nil, fmt.Errorf("submodule %s: %w", dir, err)
+	}
+
+	g.submodules[dir] = newGoGit(subDir, repo)
+	return g.submodules[dir], nil
+}
@@ -0,0 +1,94 @@
+package patrol_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+func TestVCS(t *testing.T) {
+	const module = "github.com/utilitywarehouse/options"
+
+	for _, backend := range []patrol.VCSBackend{patrol.VCSGoGit, patrol.VCSGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			tmp, commits := newTestRepo(t,
+				"testdata/options/commits/1",
+				"testdata/options/commits/2",
+				"testdata/options/commits/3",
+			)
+
+			repo, err := patrol.NewRepo(tmp, patrol.VCS(backend), patrol.APISurface())
+			require.NoError(t, err)
+
+			_, err = repo.Changes(context.Background(), "not-fetched")
+			assert.ErrorIs(t, err, patrol.ErrRevisionNotFound)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = repo.Changes(ctx, commits[1])
+			assert.ErrorIs(t, err, context.Canceled)
+
+			changes, err := repo.Changes(context.Background(), commits[1])
+			require.NoError(t, err)
+			assert.Equal(t, []string{module + "/pkg/qux"}, changes)
+			assert.Equal(t, patrol.ChangedImplementation, repo.Packages[module+"/pkg/qux"].ChangeKind)
+
+			repo, err = patrol.NewRepo(tmp, patrol.VCS(backend), patrol.Target(commits[0]), patrol.MergeBase())
+			require.NoError(t, err)
+
+			changes, err = repo.Changes(context.Background(), commits[2])
+			require.NoError(t, err)
+			assert.Empty(t, changes)
+
+			require.NoError(t, os.WriteFile(filepath.Join(tmp, "pkg", "qux", "new.go"),
+				[]byte("package qux\n"), 0o644))
+
+			repo, err = patrol.NewRepo(tmp, patrol.VCS(backend), patrol.Worktree())
+			require.NoError(t, err)
+
+			changes, err = repo.Changes(context.Background(), commits[2])
+			require.NoError(t, err)
+			assert.Equal(t, []string{module + "/pkg/qux"}, changes)
+		})
+	}
+}
+
+func TestLoadRevision(t *testing.T) {
+	for _, backend := range []patrol.VCSBackend{patrol.VCSGoGit, patrol.VCSGit} {
+		t.Run(string(backend), func(t *testing.T) {
+			tmp, commits := newTestRepo(t,
+				"testdata/options/commits/1",
+				"testdata/options/commits/2",
+				"testdata/options/commits/3",
+			)
+
+			repo, err := patrol.NewRepo(tmp, patrol.VCS(backend))
+			require.NoError(t, err)
+
+			// revisions are read from git only
+			require.NoError(t, os.RemoveAll(filepath.Join(tmp, "pkg")))
+
+			for i := 1; i < len(commits); i++ {
+				require.NoError(t, repo.LoadRevision(commits[i]))
+
+				changes, err := repo.Changes(context.Background(), commits[i-1])
+				require.NoError(t, err)
+				assert.ElementsMatch(t, expectedChanges(t, fmt.Sprintf("testdata/options/commits/%d", i+1)), changes)
+			}
+
+			err = repo.LoadRevision("not-fetched")
+			assert.ErrorIs(t, err, patrol.ErrRevisionNotFound)
+
+			repo, err = patrol.NewRepo(tmp, patrol.Worktree())
+			require.NoError(t, err)
+			assert.Error(t, repo.LoadRevision(commits[0]))
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/utilitywarehouse/patrol/patrol"
+)
+
+// runStats runs patrol stats, which reports how often packages changed and
+// how many packages they affected, and returns the exit code.
+func runStats(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: patrol stats [-since=90d] [flags] <path>\n")
+		flags.PrintDefaults()
+	}
+
+	since := flags.String("since", "90d", "how far back to look, as a duration (e.g. 90d, 12w "+
+		"or 720h) or a date (e.g. 2024-01-31)")
+	format := flags.String("format", "table", "output format: table or csv")
+	allFiles := flags.Bool("all-files", false, "detect changes in all files, not just go files")
+	semanticDiff := flags.Bool("semantic-diff", false, "ignore changes to go files "+
+		"that only affect comments or formatting")
+	symbols := flags.Bool("symbols", false, "only flag dependants referencing "+
+		"the declarations that changed")
+	modCache := flags.String("modcache", "", "module cache used to work out which "+
+		"packages of updated dependencies changed")
+	modGraph := flags.String("modgraph", "", "file containing the output of go mod graph, "+
+		"used to flag importers of modules requiring changed dependencies")
+
+	var filter patrol.PackageFilter
+	flags.Var((*patternsFlag)(&filter.Match), "match", "only report packages matching "+
+		"this package pattern, can be repeated")
+	flags.Var((*patternsFlag)(&filter.Exclude), "exclude", "don't report packages matching "+
+		"this package pattern, can be repeated")
+
+	flags.Parse(args) // nolint
+
+	if flags.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "please provide the path to the repository\n")
+		return 1
+	}
+
+	from, err := parseSince(*since, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid value for `since` flag: %s\n", err.Error())
+		return 1
+	}
+
+	if *format != "table" && *format != "csv" {
+		fmt.Fprintf(os.Stderr, "invalid value for `format` flag: %s\n", *format)
+		return 1
+	}
+
+	var options []patrol.Option
+	if *semanticDiff {
+		options = append(options, patrol.SemanticDiff())
+	}
+	if *symbols {
+		options = append(options, patrol.SymbolLevel())
+	}
+	if *modCache != "" {
+		options = append(options, patrol.ModCache(*modCache))
+	}
+	if *modGraph != "" {
+		options = append(options, patrol.ModGraph(*modGraph))
+	}
+
+	repo, err := patrol.NewRepo(flags.Arg(0), options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	stats, err := repo.Stats(from, *allFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	var packages []patrol.PackageStats
+	for _, pkg := range stats.Packages {
+		if len(repo.FilterPackages([]string{pkg.Name}, filter)) > 0 {
+			packages = append(packages, pkg)
+		}
+	}
+	stats.Packages = packages
+
+	if err := printStats(os.Stdout, stats, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// parseSince returns the time since refers to: either a date (2006-01-02) or
+// a duration before now, which can also be given in days (90d) or weeks (12w).
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", since); err == nil {
+		return t, nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(since, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid duration %q", since)
+			}
+			return now.Add(-time.Duration(count) * unit), nil
+		}
+	}
+
+	d, err := time.ParseDuration(since)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-d), nil
+}
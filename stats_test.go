@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"90d":        now.Add(-90 * 24 * time.Hour),
+		"2w":         now.Add(-14 * 24 * time.Hour),
+		"36h":        now.Add(-36 * time.Hour),
+		"2024-01-31": time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+
+	for since, expected := range tests {
+		t.Run(since, func(t *testing.T) {
+			actual, err := parseSince(since, now)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	_, err := parseSince("xd", now)
+	assert.Error(t, err)
+}